@@ -0,0 +1,185 @@
+package main
+
+import "math"
+
+//  ██████╗ ██████╗ ███╗   ███╗██████╗ ██╗███╗   ██╗███████╗
+// ██╔════╝██╔═══██╗████╗ ████║██╔══██╗██║████╗  ██║██╔════╝
+// ██║     ██║   ██║██╔████╔██║██████╔╝██║██╔██╗ ██║█████╗
+// ██║     ██║   ██║██║╚██╔╝██║██╔══██╗██║██║╚██╗██║██╔══╝
+// ╚██████╗╚██████╔╝██║ ╚═╝ ██║██████╔╝██║██║ ╚████║███████╗
+//  ╚═════╝ ╚═════╝ ╚═╝     ╚═╝╚═════╝ ╚═╝╚═╝  ╚═══╝╚══════╝
+
+// Combinations are oscillators made of other oscillators: hard sync, ring and amplitude modulation,
+// cross-fades and sub-oscillators. Each is an Osciller, so can be a Note's Osc or an input to another.
+// Retuning one retunes its inputs, keeping their intervals; each input is played once per sample.
+
+// freqer is anything that knows its frequency
+type freqer interface {
+	Freq() Hertz
+}
+
+// retuner keeps a combination's inputs in tune with each other as it is retuned
+type retuner struct {
+	inputs []Osciller
+	ratios []Hertz // Of each input's frequency to the combination's; 0 if not known
+	ν      Hertz
+}
+
+// newRetuner takes the combination's frequency from the first input that knows its own
+func newRetuner(inputs ...Osciller) retuner {
+	rt := retuner{inputs: inputs, ratios: make([]Hertz, len(inputs))}
+	for _, in := range inputs {
+		if f, ok := in.(freqer); ok && f.Freq() > 0 {
+			rt.ν = f.Freq()
+			break
+		}
+	}
+	for i, in := range inputs {
+		if f, ok := in.(freqer); ok && rt.ν > 0 {
+			rt.ratios[i] = f.Freq() / rt.ν
+		}
+	}
+	return rt
+}
+
+// NewFreq retunes every input that can be
+func (rt *retuner) NewFreq(ν Hertz) {
+	for i, in := range rt.inputs {
+		if tn, ok := in.(Tuner); ok && rt.ratios[i] > 0 {
+			tn.NewFreq(ν * rt.ratios[i])
+		}
+	}
+	rt.ν = ν
+}
+
+// Freq is
+func (rt *retuner) Freq() Hertz {
+	return rt.ν
+}
+
+// Release passes on to the inputs
+func (rt *retuner) Release(t Seconds) {
+	for _, in := range rt.inputs {
+		if r, ok := in.(Releaser); ok {
+			r.Release(t)
+		}
+	}
+}
+
+// HardSync restarts the slave's cycle whenever the master starts one, so the slave's pitch becomes
+// a change of timbre (sweeping it gives the classic sync sound). Only the slave is heard.
+type HardSync struct {
+	retuner
+	Master Osciller
+	Slave  *Oscillator
+	cycles float64 // Master cycles so far, if it is an Oscillator
+	last   Volts   // Master's last level, otherwise
+}
+
+// NewHardSync syncs slave to master
+func NewHardSync(master Osciller, slave *Oscillator) *HardSync {
+	return &HardSync{retuner: newRetuner(master, slave), Master: master, Slave: slave}
+}
+
+// Amplitude is
+func (hs *HardSync) Amplitude(t Seconds) Volts {
+	m := hs.Master.Amplitude(t)
+	a := hs.Slave.Amplitude(t)
+	if mo, ok := hs.Master.(*Oscillator); ok {
+		c := math.Floor(float64(mo.Phase) / τ)
+		if c != hs.cycles { // restart the slave as far into its cycle as the master now is
+			hs.cycles = c
+			since := cycle(mo.Phase) / τ / float64(mo.Freq())
+			hs.Slave.Phase = Angle(τ * since * float64(hs.Slave.Freq()))
+			a = hs.Slave.Wave(hs.Slave.Phase)
+		}
+		return a
+	}
+	if hs.last < 0 && m >= 0 { // otherwise each upward zero crossing starts a cycle
+		hs.Slave.Phase = 0
+		a = hs.Slave.Wave(0)
+	}
+	hs.last = m
+	return a
+}
+
+// RingMod multiplies two oscillators, giving their sum and difference frequencies and neither input
+type RingMod struct {
+	retuner
+	A, B Osciller
+}
+
+// NewRingMod makes one
+func NewRingMod(a, b Osciller) *RingMod {
+	return &RingMod{retuner: newRetuner(a, b), A: a, B: b}
+}
+
+// Amplitude is
+func (rm *RingMod) Amplitude(t Seconds) Volts {
+	return rm.A.Amplitude(t) * rm.B.Amplitude(t)
+}
+
+// AM varies a carrier's level with a modulator; unlike ring modulation the carrier is still heard
+type AM struct {
+	retuner
+	Carrier, Modulator Osciller
+	Depth              float64 // 0 (just the carrier) ... 1 (the modulator takes the level right down to 0)
+}
+
+// NewAM makes one
+func NewAM(carrier, modulator Osciller, depth float64) *AM {
+	return &AM{retuner: newRetuner(carrier, modulator), Carrier: carrier, Modulator: modulator, Depth: depth}
+}
+
+// Amplitude is
+func (am *AM) Amplitude(t Seconds) Volts {
+	m := (am.Modulator.Amplitude(t) + 1) / 2
+	return am.Carrier.Amplitude(t) * Volts(1-am.Depth+am.Depth*float64(m))
+}
+
+// Crossfade mixes two oscillators linearly; Mix can be modulated, e.g. with AddField("mix", &cf.Mix)
+type Crossfade struct {
+	retuner
+	A, B Osciller
+	Mix  float64 // 0 (all A) ... 1 (all B)
+}
+
+// NewCrossfade makes one
+func NewCrossfade(a, b Osciller, mix float64) *Crossfade {
+	return &Crossfade{retuner: newRetuner(a, b), A: a, B: b, Mix: mix}
+}
+
+// Amplitude is
+func (cf *Crossfade) Amplitude(t Seconds) Volts {
+	x := math.Max(0, math.Min(1, cf.Mix))
+	return Volts(1-x)*cf.A.Amplitude(t) + Volts(x)*cf.B.Amplitude(t)
+}
+
+// SubOsc adds an oscillator one or two octaves below another, for weight
+type SubOsc struct {
+	retuner
+	Main  Osciller
+	Sub   *Oscillator
+	Level float64 // Of the sub, relative to the main oscillator
+}
+
+// NewSubOsc adds a sub of the given wave, octaves (1 or 2) below main, which is at ν, starting at global time t
+func NewSubOsc(t Seconds, main Osciller, ν Hertz, octaves int, wave Waveform, level float64) *SubOsc {
+	if octaves < 1 {
+		octaves = 1
+	}
+	if octaves > 2 {
+		octaves = 2
+	}
+	sub := NewWave(t, ν/Hertz(math.Pow(2, float64(octaves))), wave)
+	so := &SubOsc{retuner: newRetuner(main, sub), Main: main, Sub: sub, Level: level}
+	if so.ν == 0 { // main doesn't know its frequency, so the sub sets the ratio
+		so.ratios[0], so.ratios[1], so.ν = 0, sub.Freq()/ν, ν
+	}
+	return so
+}
+
+// Amplitude is the mix, scaled to stay within +-1
+func (so *SubOsc) Amplitude(t Seconds) Volts {
+	return (so.Main.Amplitude(t) + Volts(so.Level)*so.Sub.Amplitude(t)) / Volts(1+so.Level)
+}
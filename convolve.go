@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+//  ██████╗ ██████╗ ███╗   ██╗██╗   ██╗ ██████╗ ██╗     ██╗   ██╗███████╗
+// ██╔════╝██╔═══██╗████╗  ██║██║   ██║██╔═══██╗██║     ██║   ██║██╔════╝
+// ██║     ██║   ██║██╔██╗ ██║██║   ██║██║   ██║██║     ██║   ██║█████╗
+// ██║     ██║   ██║██║╚██╗██║╚██╗ ██╔╝██║   ██║██║     ╚██╗ ██╔╝██╔══╝
+// ╚██████╗╚██████╔╝██║ ╚████║ ╚████╔╝ ╚██████╔╝███████╗ ╚████╔╝ ███████╗
+//  ╚═════╝ ╚═════╝ ╚═╝  ╚═══╝  ╚═══╝   ╚═════╝ ╚══════╝  ╚═══╝  ╚══════╝
+
+// Convolution reverb places the sound in a real space by convolving it with a recorded impulse response (IR).
+// The IR is cut into equal partitions, each transformed once at load; the input is transformed a block
+// at a time and multiplied against every partition (uniformly partitioned overlap-save), so the latency
+// is just one block however long the IR is.
+
+// fft is a radix 2 complex FFT of a fixed size, with its tables worked out in advance
+type fft struct {
+	n       int
+	twiddle []complex128
+	rev     []int
+}
+
+// newFFT makes one of size n, which must be a power of 2
+func newFFT(n int) *fft {
+	f := &fft{n: n, twiddle: make([]complex128, n/2), rev: make([]int, n)}
+	for i := range f.twiddle {
+		f.twiddle[i] = cmplx.Exp(complex(0, -τ*float64(i)/float64(n)))
+	}
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	for i := range f.rev {
+		r := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<b) != 0 {
+				r |= 1 << (bits - 1 - b)
+			}
+		}
+		f.rev[i] = r
+	}
+	return f
+}
+
+// transform does the FFT of x in place, or the (scaled) inverse
+func (f *fft) transform(x []complex128, inverse bool) {
+	for i, r := range f.rev {
+		if i < r {
+			x[i], x[r] = x[r], x[i]
+		}
+	}
+	for size := 2; size <= f.n; size <<= 1 {
+		half, step := size/2, f.n/size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < half; k++ {
+				w := f.twiddle[k*step]
+				if inverse {
+					w = cmplx.Conj(w)
+				}
+				a, b := x[start+k], x[start+k+half]*w
+				x[start+k], x[start+k+half] = a+b, a-b
+			}
+		}
+	}
+	if inverse {
+		scale := complex(1/float64(f.n), 0)
+		for i := range x {
+			x[i] *= scale
+		}
+	}
+}
+
+// IROptions say how to prepare an impulse response
+type IROptions struct {
+	TrimStart  Seconds // Cut this much off the front (e.g. the silence before the direct sound)
+	TrimBelow  float64 // If non zero, also cut leading samples quieter than this many dB below the peak
+	MaxLength  Seconds // If non zero, shorten the IR to this, fading out the end
+	PreDelay   Seconds // Gap before the reverb starts
+	Normalize  bool    // Scale the IR to unit energy, so the reverb is about as loud as the dry signal
+	GainDB     float64 // Then apply this gain
+	BlockSize  int     // Samples per partition (a power of 2), which is also the latency; 0 means 512
+	Mix        float64 // 0 all dry, 1 all wet
+	ResampleTo Hertz   // Sample rate to run at (the synth's SR)
+}
+
+// convChannel is one channel of partitioned convolution
+type convChannel struct {
+	parts  [][]complex128 // Spectra of the IR partitions
+	fdl    [][]complex128 // Spectra of past input blocks, newest first
+	inBuf  []float64      // Last two blocks of input
+	outBuf []float64      // Output for the block now playing
+	work   []complex128
+	acc    []complex128
+}
+
+// Convolver is a stereo convolution reverb
+type Convolver struct {
+	SR    Hertz
+	Mix   float64 // 0 all dry, 1 all wet
+	block int
+	f     *fft
+	ch    [2]*convChannel
+	pos   int // Position within the current block
+}
+
+// LoadIR reads a mono or stereo IR from a WAV file and makes a Convolver from it
+func LoadIR(path string, opt IROptions) (*Convolver, error) {
+	smp, err := LoadSample(path)
+	if err != nil {
+		return nil, err
+	}
+	if smp.Len() == 0 {
+		return nil, fmt.Errorf("impulse response %s is empty", path)
+	}
+	sr := opt.ResampleTo
+	if sr == 0 {
+		sr = smp.SR
+	}
+	l, r := resample(smp.L, smp.SR, sr), resample(smp.R, smp.SR, sr)
+	return NewConvolver(sr, l, r, opt), nil
+}
+
+// NewConvolver prepares the IRs l and r (the same slice for a mono IR) for real time use
+func NewConvolver(sr Hertz, l, r []float64, opt IROptions) *Convolver {
+	l, r = prepareIR(sr, l, r, opt)
+	block := opt.BlockSize
+	if block <= 0 {
+		block = 512
+	}
+	for block&(block-1) != 0 { // round up to a power of 2
+		block++
+	}
+	cv := &Convolver{SR: sr, Mix: opt.Mix, block: block, f: newFFT(2 * block)}
+	cv.ch[0] = cv.newChannel(l)
+	cv.ch[1] = cv.newChannel(r)
+	return cv
+}
+
+// prepareIR trims, delays and scales a pair of IRs
+func prepareIR(sr Hertz, l, r []float64, opt IROptions) ([]float64, []float64) {
+	start := int(float64(opt.TrimStart * Seconds(sr)))
+	if opt.TrimBelow != 0 {
+		peak := 0.0
+		for i := range l {
+			peak = math.Max(peak, math.Max(math.Abs(l[i]), math.Abs(r[i])))
+		}
+		floor := peak * math.Pow(10, -math.Abs(opt.TrimBelow)/20)
+		for start < len(l) && math.Abs(l[start]) < floor && math.Abs(r[start]) < floor {
+			start++
+		}
+	}
+	if start >= len(l) {
+		start = len(l) - 1
+	}
+	end := len(l)
+	if n := int(float64(opt.MaxLength * Seconds(sr))); opt.MaxLength > 0 && start+n < end {
+		end = start + n
+	}
+	pre := int(float64(opt.PreDelay * Seconds(sr)))
+	nl, nr := make([]float64, pre+end-start), make([]float64, pre+end-start)
+	copy(nl[pre:], l[start:end])
+	copy(nr[pre:], r[start:end])
+	if end < len(l) { // fade out over the last 10% so the cut isn't heard
+		fade := (end - start) / 10
+		for i := 0; i < fade; i++ {
+			g := float64(i) / float64(fade)
+			nl[len(nl)-1-i] *= g
+			nr[len(nr)-1-i] *= g
+		}
+	}
+	gain := math.Pow(10, opt.GainDB/20)
+	if opt.Normalize {
+		e := 0.0
+		for i := range nl {
+			e += nl[i]*nl[i] + nr[i]*nr[i]
+		}
+		if e > 0 {
+			gain /= math.Sqrt(e / 2)
+		}
+	}
+	for i := range nl {
+		nl[i] *= gain
+		nr[i] *= gain
+	}
+	return nl, nr
+}
+
+// resample converts x from one sample rate to another with a windowed sinc interpolator
+func resample(x []float64, from, to Hertz) []float64 {
+	if from == to || len(x) == 0 {
+		return x
+	}
+	const taps = 16
+	ratio := float64(from / to)
+	cut := math.Min(1, 1/ratio) // low pass below the lower of the two Nyquists
+	out := make([]float64, int(float64(len(x))/ratio))
+	for n := range out {
+		t := float64(n) * ratio
+		c := int(t)
+		sum := 0.0
+		for k := c - taps + 1; k <= c+taps; k++ {
+			if k < 0 || k >= len(x) {
+				continue
+			}
+			d := t - float64(k)
+			w := 0.5 + 0.5*math.Cos(π*d/taps) // Hann window
+			s := cut
+			if d != 0 {
+				s = math.Sin(π*d*cut) / (π * d)
+			}
+			sum += x[k] * s * w
+		}
+		out[n] = sum
+	}
+	return out
+}
+
+// newChannel cuts an IR into partitions and transforms them
+func (cv *Convolver) newChannel(ir []float64) *convChannel {
+	b := cv.block
+	nParts := (len(ir) + b - 1) / b
+	ch := &convChannel{
+		inBuf:  make([]float64, 2*b),
+		outBuf: make([]float64, b),
+		work:   make([]complex128, 2*b),
+		acc:    make([]complex128, 2*b),
+	}
+	for p := 0; p < nParts; p++ {
+		spec := make([]complex128, 2*b)
+		for i := 0; i < b && p*b+i < len(ir); i++ {
+			spec[i] = complex(ir[p*b+i], 0)
+		}
+		cv.f.transform(spec, false)
+		ch.parts = append(ch.parts, spec)
+		ch.fdl = append(ch.fdl, make([]complex128, 2*b))
+	}
+	return ch
+}
+
+// run convolves the block just collected in inBuf, leaving the result in outBuf
+func (cv *Convolver) run(ch *convChannel) {
+	b := cv.block
+	// the oldest spectrum's storage is recycled for the newest
+	last := ch.fdl[len(ch.fdl)-1]
+	copy(ch.fdl[1:], ch.fdl[:len(ch.fdl)-1])
+	ch.fdl[0] = last
+	for i, x := range ch.inBuf {
+		last[i] = complex(x, 0)
+	}
+	cv.f.transform(last, false)
+	for i := range ch.acc {
+		ch.acc[i] = 0
+	}
+	for p, h := range ch.parts {
+		x := ch.fdl[p]
+		for i := range ch.acc {
+			ch.acc[i] += x[i] * h[i]
+		}
+	}
+	cv.f.transform(ch.acc, true)
+	for i := 0; i < b; i++ { // overlap-save: only the second half is clean
+		ch.outBuf[i] = real(ch.acc[b+i])
+	}
+	copy(ch.inBuf, ch.inBuf[b:])
+}
+
+// Latency is the delay (in samples) of the wet signal
+func (cv *Convolver) Latency() int {
+	return cv.block
+}
+
+// Process is
+func (cv *Convolver) Process(samples [][2]float64) {
+	b := cv.block
+	for i := range samples {
+		for c, ch := range cv.ch {
+			in := samples[i][c]
+			ch.inBuf[b+cv.pos] = in
+			samples[i][c] = (1-cv.Mix)*in + cv.Mix*ch.outBuf[cv.pos]
+		}
+		cv.pos++
+		if cv.pos == b {
+			cv.pos = 0
+			for _, ch := range cv.ch {
+				cv.run(ch)
+			}
+		}
+	}
+}
+
+// Offline convolves a whole recording, returning the wet signal including its tail, lined up with the input
+// (i.e. with the block latency removed). It uses (and disturbs) the same state as Process.
+func (cv *Convolver) Offline(in [][2]float64) [][2]float64 {
+	mix := cv.Mix
+	cv.Mix = 1
+	defer func() { cv.Mix = mix }()
+	tail := len(cv.ch[0].parts) * cv.block
+	buf := make([][2]float64, len(in)+tail+cv.block)
+	copy(buf, in)
+	cv.Process(buf)
+	return buf[cv.block:]
+}
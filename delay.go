@@ -0,0 +1,205 @@
+package main
+
+import (
+	"math"
+)
+
+// ██████╗ ███████╗██╗      █████╗ ██╗   ██╗
+// ██╔══██╗██╔════╝██║     ██╔══██╗╚██╗ ██╔╝
+// ██║  ██║█████╗  ██║     ███████║ ╚████╔╝
+// ██║  ██║██╔══╝  ██║     ██╔══██║  ╚██╔╝
+// ██████╔╝███████╗███████╗██║  ██║   ██║
+// ╚═════╝ ╚══════╝╚══════╝╚═╝  ╚═╝   ╚═╝
+
+// Delays and echoes, as Effecters for the master output (or anywhere else a stereo block is processed)
+
+// Tempo is the speed of the music, shared by anything that syncs to it so a change is heard everywhere
+type Tempo struct {
+	BPM float64 // Quarter notes per minute
+}
+
+// Division is a length of note as a fraction of a whole note, e.g. 1/4 for a quarter note
+type Division float64
+
+// Common note divisions
+const (
+	Whole            Division = 1
+	Half             Division = 1.0 / 2
+	Quarter          Division = 1.0 / 4
+	Eighth           Division = 1.0 / 8
+	Sixteenth        Division = 1.0 / 16
+	DottedQuarter    Division = Quarter * 3 / 2
+	DottedEighth     Division = Eighth * 3 / 2
+	QuarterTriplet   Division = Half / 3
+	EighthTriplet    Division = Quarter / 3
+	SixteenthTriplet Division = Eighth / 3
+)
+
+// Duration is how long a division lasts at this tempo
+func (tp *Tempo) Duration(d Division) Seconds {
+	return Seconds(60 / tp.BPM * 4 * float64(d))
+}
+
+// delayLine is a ring buffer that can be read at any (fractional) number of samples in the past
+type delayLine struct {
+	buf []float64
+	w   int // Next slot to write
+}
+
+// newDelayLine makes one able to delay by up to n samples
+func newDelayLine(n int) *delayLine {
+	return &delayLine{buf: make([]float64, n+2)}
+}
+
+// write pushes a sample in
+func (dl *delayLine) write(x float64) {
+	dl.buf[dl.w] = x
+	dl.w++
+	if dl.w == len(dl.buf) {
+		dl.w = 0
+	}
+}
+
+// read returns the sample d samples ago (1 being the last one written), linearly interpolated
+func (dl *delayLine) read(d float64) float64 {
+	d = math.Max(1, math.Min(d, float64(len(dl.buf)-2)))
+	i := int(d)
+	frac := d - float64(i)
+	a := dl.w - i
+	if a < 0 {
+		a += len(dl.buf)
+	}
+	b := a - 1
+	if b < 0 {
+		b += len(dl.buf)
+	}
+	return dl.buf[a] + frac*(dl.buf[b]-dl.buf[a])
+}
+
+// sineLFO is a minimal low frequency oscillator for effects to wobble their settings with
+type sineLFO struct {
+	phase Angle
+	step  Angle // Per sample
+}
+
+// newSineLFO makes one at rate ν for sample rate sr, starting at phase
+func newSineLFO(ν Hertz, sr Hertz, phase Angle) *sineLFO {
+	return &sineLFO{phase: phase, step: Angle(τ * float64(ν/sr))}
+}
+
+// next returns the current value (-1...+1) and moves on a sample
+func (lfo *sineLFO) next() float64 {
+	v := math.Sin(float64(lfo.phase))
+	lfo.phase += lfo.step
+	if lfo.phase > τ {
+		lfo.phase -= τ
+	}
+	return v
+}
+
+// DelayMode is how a Delay treats the two channels
+type DelayMode int
+
+// Delay modes
+const (
+	MonoDelay     DelayMode = iota // Both channels summed into one echo, heard in both
+	StereoDelay                    // Each channel echoes by itself
+	PingPongDelay                  // Echoes bounce from one side to the other
+)
+
+// Delay is an echo with feedback, a damping filter in the loop and optionally a wobbling delay time
+type Delay struct {
+	Mode       DelayMode
+	SR         Hertz
+	Time       Seconds  // Delay time, unless synced
+	Sync       Division // If non zero (and Tempo is set), the delay is this division of the Tempo
+	Tempo      *Tempo   //
+	RightScale float64  // Right delay time as a multiple of the left (stereo only)
+	Feedback   float64  // 0...1, how much of the echo comes round again
+	Mix        float64  // 0 all dry, 1 all wet
+	ModDepth   Seconds  // How far the delay time wobbles
+	ModRate    Hertz    // How quickly it wobbles
+	dampL      *Biquad  // Damping filters in the loop
+	dampR      *Biquad  //
+	lineL      *delayLine
+	lineR      *delayLine
+	lfo        *sineLFO
+	lfoRate    Hertz   // Rate the lfo was made for
+	cur        float64 // Smoothed delay, in samples
+	smooth     float64
+}
+
+// NewDelay makes one able to echo up to maxTime, with damping above damp Hz
+func NewDelay(mode DelayMode, sr Hertz, maxTime Seconds, time Seconds, feedback float64, mix float64, damp Hertz) *Delay {
+	n := int(float64(maxTime)*float64(sr)) + 1
+	d := &Delay{
+		Mode:       mode,
+		SR:         sr,
+		Time:       time,
+		RightScale: 1,
+		Feedback:   feedback,
+		Mix:        mix,
+		dampL:      NewBiquad(LowPass, sr, damp, ButterworthQ),
+		dampR:      NewBiquad(LowPass, sr, damp, ButterworthQ),
+		lineL:      newDelayLine(n),
+		lineR:      newDelayLine(n),
+		smooth:     1 - math.Exp(-1/float64(0.05*sr)),
+	}
+	d.cur = d.target()
+	return d
+}
+
+// SyncTo locks the delay time to a division of a tempo
+func (d *Delay) SyncTo(tp *Tempo, div Division) *Delay {
+	d.Tempo, d.Sync = tp, div
+	d.cur = d.target()
+	return d
+}
+
+// SetDamping moves the cutoff of the damping filters
+func (d *Delay) SetDamping(f Hertz) {
+	d.dampL.SetCutoff(f)
+	d.dampR.SetCutoff(f)
+}
+
+// target is the delay time wanted, in samples
+func (d *Delay) target() float64 {
+	t := d.Time
+	if d.Tempo != nil && d.Sync > 0 {
+		t = d.Tempo.Duration(d.Sync)
+	}
+	return float64(t * Seconds(d.SR))
+}
+
+// Process is
+func (d *Delay) Process(samples [][2]float64) {
+	if d.lfo == nil || d.lfoRate != d.ModRate {
+		d.lfo = newSineLFO(d.ModRate, d.SR, 0)
+		d.lfoRate = d.ModRate
+	}
+	want := d.target()
+	for i := range samples {
+		d.cur = glide(d.cur, want, d.smooth) // a changed time slides like tape, rather than clicking
+		dt := d.cur + float64(d.ModDepth*Seconds(d.SR))*d.lfo.next()
+		inL, inR := samples[i][0], samples[i][1]
+		var wetL, wetR float64
+		switch d.Mode {
+		case MonoDelay:
+			wetL = d.lineL.read(dt)
+			wetR = wetL
+			d.lineL.write((inL+inR)/2 + d.Feedback*float64(d.dampL.Filter(Volts(wetL))))
+		case StereoDelay:
+			wetL = d.lineL.read(dt)
+			wetR = d.lineR.read(dt * d.RightScale)
+			d.lineL.write(inL + d.Feedback*float64(d.dampL.Filter(Volts(wetL))))
+			d.lineR.write(inR + d.Feedback*float64(d.dampR.Filter(Volts(wetR))))
+		case PingPongDelay:
+			wetL = d.lineL.read(dt)
+			wetR = d.lineR.read(dt)
+			d.lineL.write((inL+inR)/2 + d.Feedback*float64(d.dampR.Filter(Volts(wetR))))
+			d.lineR.write(float64(d.dampL.Filter(Volts(wetL))))
+		}
+		samples[i][0] = (1-d.Mix)*inL + d.Mix*wetL
+		samples[i][1] = (1-d.Mix)*inR + d.Mix*wetR
+	}
+}
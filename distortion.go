@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+)
+
+// ██████╗ ██╗███████╗████████╗ ██████╗ ██████╗ ████████╗██╗ ██████╗ ███╗   ██╗
+// ██╔══██╗██║██╔════╝╚══██╔══╝██╔═══██╗██╔══██╗╚══██╔══╝██║██╔═══██╗████╗  ██║
+// ██║  ██║██║███████╗   ██║   ██║   ██║██████╔╝   ██║   ██║██║   ██║██╔██╗ ██║
+// ██║  ██║██║╚════██║   ██║   ██║   ██║██╔══██╗   ██║   ██║██║   ██║██║╚██╗██║
+// ██████╔╝██║███████║   ██║   ╚██████╔╝██║  ██║   ██║   ██║╚██████╔╝██║ ╚████║
+// ╚═════╝ ╚═╝╚══════╝   ╚═╝    ╚═════╝ ╚═╝  ╚═╝   ╚═╝   ╚═╝ ╚═════╝ ╚═╝  ╚═══╝
+
+// Distortion bends the signal through a transfer curve, adding harmonics. Both the Waveshaper and the
+// Bitcrusher are Filterers, so they can go in a note (FilteredOsc) or, as a pair, on the master (FilterEffect).
+
+// ShapeCurve is the transfer curve of a Waveshaper
+type ShapeCurve int
+
+// Transfer curves
+const (
+	TanhCurve      ShapeCurve = iota // Smooth, symmetric saturation (odd harmonics)
+	DiodeCurve                       // Asymmetric, clips one side harder (adds even harmonics)
+	FoldbackCurve                    // Folds back on itself past ±1, very bright
+	ChebyshevCurve                   // Sum of Chebyshev polynomials, each adding exactly one harmonic
+	TableCurve                       // User table, spanning inputs from -1 to +1
+)
+
+// Waveshaper distorts a signal, oversampling so that the new harmonics don't alias back down
+type Waveshaper struct {
+	Curve      ShapeCurve
+	Drive      float64   // Gain into the curve
+	Bias       float64   // Offset into the curve, for asymmetry
+	Harmonics  []float64 // Weights of T1, T2, ... for ChebyshevCurve
+	Table      []float64 // Curve for TableCurve
+	Output     Volts     // Gain after the curve
+	Mix        float64   // 0 all dry, 1 all wet
+	oversample int
+	up, down   Cascade // Anti-imaging and anti-aliasing filters at the oversampled rate
+	dcX, dcY   float64 // DC blocker state
+}
+
+// NewWaveshaper makes one running at sample rate sr, oversampling by factor (1, 2, 4 or 8)
+func NewWaveshaper(sr Hertz, curve ShapeCurve, drive float64, factor int) *Waveshaper {
+	if factor < 1 {
+		factor = 1
+	}
+	ws := &Waveshaper{Curve: curve, Drive: drive, Output: 1, Mix: 1, oversample: factor}
+	if factor > 1 {
+		osr := sr * Hertz(factor)
+		ws.up = NewButterworth(LowPass, osr, 0.45*sr, 8)
+		ws.down = NewButterworth(LowPass, osr, 0.45*sr, 8)
+	}
+	return ws
+}
+
+// shape applies the transfer curve
+func (ws *Waveshaper) shape(x float64) float64 {
+	switch ws.Curve {
+	case DiodeCurve:
+		if x >= 0 {
+			return 1 - math.Exp(-x)
+		}
+		return -0.5 * (1 - math.Exp(2*x))
+	case FoldbackCurve:
+		if x > 1 || x < -1 {
+			return math.Abs(math.Abs(math.Mod(x-1, 4))-2) - 1
+		}
+		return x
+	case ChebyshevCurve:
+		x = math.Max(-1, math.Min(1, x))
+		y, tPrev, tCur := 0.0, 1.0, x // T0, T1
+		for _, w := range ws.Harmonics {
+			y += w * tCur
+			tPrev, tCur = tCur, 2*x*tCur-tPrev
+		}
+		return y
+	case TableCurve:
+		n := len(ws.Table)
+		if n == 0 {
+			return x
+		}
+		if n == 1 {
+			return ws.Table[0]
+		}
+		p := (math.Max(-1, math.Min(1, x)) + 1) / 2 * float64(n-1)
+		i := int(p)
+		if i >= n-1 {
+			return ws.Table[n-1]
+		}
+		return ws.Table[i] + (p-float64(i))*(ws.Table[i+1]-ws.Table[i])
+	}
+	return math.Tanh(x)
+}
+
+// Filter distorts one sample
+func (ws *Waveshaper) Filter(x Volts) Volts {
+	in := float64(x)
+	var y float64
+	if ws.oversample == 1 {
+		y = ws.shape(ws.Drive*in + ws.Bias)
+	} else {
+		// zero stuff, smooth, shape, smooth, keep one
+		for k := 0; k < ws.oversample; k++ {
+			u := 0.0
+			if k == 0 {
+				u = in * float64(ws.oversample)
+			}
+			u = float64(ws.up.Filter(Volts(u)))
+			v := float64(ws.down.Filter(Volts(ws.shape(ws.Drive*u + ws.Bias))))
+			if k == 0 {
+				y = v
+			}
+		}
+	}
+	// bias and asymmetric curves leave a DC offset, so take it out
+	dc := y - ws.dcX + 0.995*ws.dcY
+	ws.dcX, ws.dcY = y, dc
+	return Volts((1-ws.Mix)*in) + Volts(ws.Mix*dc)*ws.Output
+}
+
+// Bitcrusher reduces the resolution of a signal in level (bits) and time (sample rate)
+type Bitcrusher struct {
+	SR    Hertz
+	Bits  float64 // Resolution, need not be whole
+	Rate  Hertz   // Rate to hold samples at, at most SR
+	Mix   float64 // 0 all dry, 1 all wet
+	phase float64
+	held  float64
+}
+
+// NewBitcrusher makes one
+func NewBitcrusher(sr Hertz, bits float64, rate Hertz) *Bitcrusher {
+	return &Bitcrusher{SR: sr, Bits: bits, Rate: rate, Mix: 1, phase: 1}
+}
+
+// Filter crushes one sample
+func (bc *Bitcrusher) Filter(x Volts) Volts {
+	bc.phase += float64(bc.Rate / bc.SR)
+	if bc.phase >= 1 {
+		bc.phase -= math.Floor(bc.phase)
+		steps := math.Pow(2, bc.Bits-1)
+		bc.held = math.Round(float64(x)*steps) / steps
+	}
+	return Volts((1-bc.Mix)*float64(x) + bc.Mix*bc.held)
+}
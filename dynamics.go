@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// ██████╗ ██╗   ██╗███╗   ██╗ █████╗ ███╗   ███╗██╗ ██████╗███████╗
+// ██╔══██╗╚██╗ ██╔╝████╗  ██║██╔══██╗████╗ ████║██║██╔════╝██╔════╝
+// ██║  ██║ ╚████╔╝ ██╔██╗ ██║███████║██╔████╔██║██║██║     ███████╗
+// ██║  ██║  ╚██╔╝  ██║╚██╗██║██╔══██║██║╚██╔╝██║██║██║     ╚════██║
+// ██████╔╝   ██║   ██║ ╚████║██║  ██║██║ ╚═╝ ██║██║╚██████╗███████║
+// ╚═════╝    ╚═╝   ╚═╝  ╚═══╝╚═╝  ╚═╝╚═╝     ╚═╝╚═╝ ╚═════╝╚══════╝
+
+// Dynamics processors turn the level up or down depending on how loud the signal (or a sidechain key) is.
+// All levels here are in dB relative to full scale (±1 volt).
+
+// silenceDB is treated as the level of digital silence
+const silenceDB = -120.0
+
+// DynamicsMode is what a Dynamics processor does
+type DynamicsMode int
+
+// Dynamics modes
+const (
+	Compress DynamicsMode = iota // Turn down what is above the threshold
+	Limit                        // Don't let anything past the threshold
+	Expand                       // Turn down what is below the threshold
+	Gate                         // Shut off what is below the threshold
+)
+
+// Tap is an Effecter that passes its input through untouched, keeping a copy for others to listen to,
+// e.g. as the sidechain key of a compressor. It must be processed before whatever listens to it: the mixer
+// sees to that for a Tap inserted on one track keying a Dynamics on another, otherwise it is up to the user.
+type Tap struct {
+	buf [][2]float64
+}
+
+// Process is
+func (tp *Tap) Process(samples [][2]float64) {
+	tp.buf = append(tp.buf[:0], samples...)
+}
+
+// At is sample i of the last block, or silence
+func (tp *Tap) At(i int) [2]float64 {
+	if i < len(tp.buf) {
+		return tp.buf[i]
+	}
+	return [2]float64{}
+}
+
+// Dynamics is a compressor, limiter, expander or gate
+type Dynamics struct {
+	meterGR   uint64 // Bits of a float64, for polling from other goroutines (first, to be 64 bit aligned)
+	meterIn   uint64 //
+	Mode      DynamicsMode
+	SR        Hertz
+	Threshold float64 // dB
+	Ratio     float64 // e.g. 4 for 4:1
+	Knee      float64 // Width of the soft knee, dB
+	Attack    Seconds // Time to react to the level rising
+	Release   Seconds // Time to recover when it falls
+	Range     float64 // Most the gain will be turned down, dB (expander and gate)
+	Makeup    float64 // Gain afterwards, dB
+	Sidechain *Tap    // If set, the level is measured here rather than on the input
+	gr        float64 // Current gain reduction, dB (positive)
+	attackK   float64
+	releaseK  float64
+	attackAt  Seconds // Settings the coefficients were made for
+	releaseAt Seconds
+}
+
+// NewCompressor makes one with a 6dB soft knee
+func NewCompressor(sr Hertz, threshold, ratio float64, attack, release Seconds) *Dynamics {
+	return &Dynamics{Mode: Compress, SR: sr, Threshold: threshold, Ratio: ratio, Knee: 6, Attack: attack, Release: release, Range: 120}
+}
+
+// NewLimiter makes a fast, hard kneed limiter
+func NewLimiter(sr Hertz, threshold float64) *Dynamics {
+	return &Dynamics{Mode: Limit, SR: sr, Threshold: threshold, Ratio: math.Inf(1), Attack: 0.0005, Release: 0.05, Range: 120}
+}
+
+// NewExpander makes one
+func NewExpander(sr Hertz, threshold, ratio float64, attack, release Seconds) *Dynamics {
+	return &Dynamics{Mode: Expand, SR: sr, Threshold: threshold, Ratio: ratio, Knee: 6, Attack: attack, Release: release, Range: 40}
+}
+
+// NewGate makes one that turns things down by rangeDB below the threshold
+func NewGate(sr Hertz, threshold float64, rangeDB float64, attack, release Seconds) *Dynamics {
+	return &Dynamics{Mode: Gate, SR: sr, Threshold: threshold, Ratio: math.Inf(1), Attack: attack, Release: release, Range: rangeDB}
+}
+
+// GainReduction is how far the gain is currently turned down, in dB. Safe to call from any goroutine.
+func (dy *Dynamics) GainReduction() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&dy.meterGR))
+}
+
+// InputLevel is the peak detected level over the last block, in dB. Safe to call from any goroutine.
+func (dy *Dynamics) InputLevel() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&dy.meterIn))
+}
+
+// reduction is the gain reduction (dB, positive) wanted for a level x dB
+func (dy *Dynamics) reduction(x float64) float64 {
+	t, w := dy.Threshold, dy.Knee
+	var y float64 // level out of the gain computer
+	switch dy.Mode {
+	case Compress, Limit:
+		slope := 1 / dy.Ratio
+		switch {
+		case 2*(x-t) < -w:
+			y = x
+		case 2*(x-t) <= w && w > 0:
+			d := x - t + w/2
+			y = x + (slope-1)*d*d/(2*w)
+		default:
+			y = t + (x-t)*slope
+		}
+	case Expand, Gate:
+		switch {
+		case 2*(x-t) > w:
+			y = x
+		case 2*(x-t) >= -w && w > 0 && math.IsInf(dy.Ratio, 1): // a gate's knee ramps down to its range
+			return dy.Range * (t + w/2 - x) / w
+		case 2*(x-t) >= -w && w > 0:
+			d := x - t - w/2
+			y = x - (dy.Ratio-1)*d*d/(2*w)
+		case x >= t: // only with no knee; a gate's infinite ratio would make 0*Inf
+			y = x
+		default:
+			y = t + (x-t)*dy.Ratio
+		}
+	}
+	return math.Min(math.Max(x-y, 0), dy.Range)
+}
+
+// timeConstant turns a time into a one pole smoothing coefficient
+func (dy *Dynamics) timeConstant(t Seconds) float64 {
+	if t <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-1/float64(t*Seconds(dy.SR)))
+}
+
+// Process is
+func (dy *Dynamics) Process(samples [][2]float64) {
+	if dy.attackAt != dy.Attack || dy.releaseAt != dy.Release || dy.attackK == 0 {
+		dy.attackK, dy.releaseK = dy.timeConstant(dy.Attack), dy.timeConstant(dy.Release)
+		dy.attackAt, dy.releaseAt = dy.Attack, dy.Release
+	}
+	makeup := math.Pow(10, dy.Makeup/20)
+	peak := silenceDB
+	for i := range samples {
+		key := samples[i]
+		if dy.Sidechain != nil {
+			key = dy.Sidechain.At(i)
+		}
+		lvl := math.Max(math.Abs(key[0]), math.Abs(key[1]))
+		x := silenceDB
+		if lvl > 0 {
+			x = math.Max(20*math.Log10(lvl), silenceDB)
+		}
+		peak = math.Max(peak, x)
+		want := dy.reduction(x)
+		k := dy.releaseK
+		if want > dy.gr {
+			k = dy.attackK
+		}
+		dy.gr += k * (want - dy.gr)
+		g := math.Pow(10, -dy.gr/20) * makeup
+		samples[i][0] *= g
+		samples[i][1] *= g
+	}
+	atomic.StoreUint64(&dy.meterGR, math.Float64bits(dy.gr))
+	atomic.StoreUint64(&dy.meterIn, math.Float64bits(peak))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Sweeping the level across the knee, what comes out is finite and never falls as what goes in rises
+func TestDynamicsKnee(t *testing.T) {
+	gate := NewGate(44100, -40, 30, 0.001, 0.1)
+	gate.Knee = 6
+	for _, dy := range []*Dynamics{NewExpander(44100, -40, 4, 0.001, 0.1), gate} {
+		last := math.Inf(-1)
+		for x := -60.0; x <= -20; x += 0.125 {
+			y := x - dy.reduction(x)
+			if math.IsNaN(y) || math.IsInf(y, 0) {
+				t.Fatalf("mode %d: %gdB in gives %g out", dy.Mode, x, y)
+			}
+			if y < last {
+				t.Fatalf("mode %d: %gdB in gives %gdB out, below %gdB just before", dy.Mode, x, y, last)
+			}
+			last = y
+		}
+	}
+}
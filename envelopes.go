@@ -11,7 +11,6 @@ package main
 // They should be normalized to have values between 0 and 1
 
 import (
-	"fmt"
 	"math"
 )
 
@@ -43,10 +42,27 @@ func NewEnvelope(t0 Seconds, λ Seconds, reps bool, l Seconds) *Envelope {
 	return &Envelope{T0: t0, λ: λ, Len: l}
 }
 
+// Releaser is anything that can be told when its note has been let go
+type Releaser interface {
+	Release(t Seconds) // t is the global time of the release
+}
+
+// Restarter is an envelope that can start again from the top, e.g. for a mono voice's next note
+type Restarter interface {
+	Restart(t Seconds) // t is the global time to start again
+}
+
+// Restart is
+func (env *Envelope) Restart(t Seconds) {
+	env.T0 = t
+}
+
 // ADSR is a classic ADSR envelope
 type ADSR struct {
 	Envelope
+	Tdl         Seconds      // Delay before the attack (usually 0)
 	Ta          Seconds      // Attack time (0->1)
+	Th          Seconds      // Hold time (at 1, usually 0)
 	Td          Seconds      // Decay (1->Ls)
 	Ls          Volts        // Sustain level (Ls)
 	TsMax       Seconds      // Maximum sustain time
@@ -56,14 +72,15 @@ type ADSR struct {
 	knowRelease bool         // Is release time known?
 	releaseAt   LocalSeconds // when released
 	tsActual    Seconds      // Actual sustain time (derived from keyup etc.)
+	tsGiven     Seconds      // Sustain time given at creation, if known
 }
 
 // NewADSR makes a new one, pass ts as zero if not known at creation
-func NewADSR(t0 Seconds, reps bool, ta Seconds, td Seconds, ls Volts, tsmax Seconds, tsmin Seconds, ts Seconds) *ADSR {
+func NewADSR(t0 Seconds, reps bool, ta Seconds, td Seconds, ls Volts, tr Seconds, tsmax Seconds, tsmin Seconds, ts Seconds) *ADSR {
 	if tsmax < PlanckTime {
 		tsmax = MaxNoteLen
 	}
-	adsr := ADSR{Ta: ta, Td: td, Ls: ls, TsMax: tsmax, TsMin: tsmin, tsActual: ts, sStart: LocalSeconds(ta + td)}
+	adsr := ADSR{Ta: ta, Td: td, Ls: ls, Tr: tr, TsMax: tsmax, TsMin: tsmin, tsActual: ts, tsGiven: ts, sStart: LocalSeconds(ta + td)}
 	adsr.Envelope = Envelope{T0: t0}
 	if ts > PlanckTime { // we know when release happens
 		adsr.releaseAt = LocalSeconds(ts + ta + td)
@@ -72,34 +89,99 @@ func NewADSR(t0 Seconds, reps bool, ta Seconds, td Seconds, ls Volts, tsmax Seco
 	return &adsr
 }
 
-// Release triggers the release at the given global time. Strangeness will result if called after release should have started
-func (adsr ADSR) Release(t Seconds) {
+// Delay inserts a silent stage of length tdl before the attack
+func (adsr *ADSR) Delay(tdl Seconds) *ADSR {
+	adsr.stretch(tdl - adsr.Tdl)
+	adsr.Tdl = tdl
+	return adsr
+}
+
+// Hold inserts a hold stage of length th between attack and decay
+func (adsr *ADSR) Hold(th Seconds) *ADSR {
+	adsr.stretch(th - adsr.Th)
+	adsr.Th = th
+	return adsr
+}
+
+// stretch moves the start of sustain (and a known release) later by dt
+func (adsr *ADSR) stretch(dt Seconds) {
+	adsr.sStart += LocalSeconds(dt)
+	if adsr.knowRelease {
+		adsr.releaseAt += LocalSeconds(dt)
+	}
+}
+
+// Release triggers the release at the given global time, clipped so that the sustain lasts between TsMin and TsMax.
+// An envelope that already knows its release time (e.g. a one shot) ignores this.
+func (adsr *ADSR) Release(t Seconds) {
+	if adsr.knowRelease {
+		return
+	}
 	tLocal := LocalSeconds(t - adsr.T0)
-	ts := tLocal - adsr.sStart                             // length of the sustain
-	tsact := max(min(Seconds(ts), adsr.TsMin), adsr.TsMax) // clip into valid range
-	adsr.releaseAt = LocalSeconds(tsact)
+	if adsr.TsMin > PlanckTime && tLocal < adsr.sStart+LocalSeconds(adsr.TsMin) {
+		tLocal = adsr.sStart + LocalSeconds(adsr.TsMin)
+	}
+	if tLocal > adsr.sStart+LocalSeconds(adsr.TsMax) {
+		tLocal = adsr.sStart + LocalSeconds(adsr.TsMax)
+	}
+	adsr.tsActual = max(Seconds(tLocal-adsr.sStart), 0)
+	adsr.releaseAt = tLocal
 	adsr.knowRelease = true
 }
 
+// Restart starts it again at global time t, forgetting any release (a one shot keeps its sustain time)
+func (adsr *ADSR) Restart(t Seconds) {
+	adsr.T0 = t
+	adsr.tsActual, adsr.releaseAt, adsr.knowRelease = adsr.tsGiven, 0, false
+	if adsr.tsGiven > PlanckTime {
+		adsr.releaseAt = adsr.sStart + LocalSeconds(adsr.tsGiven)
+		adsr.knowRelease = true
+	}
+}
+
 // Amplitude is
-func (adsr ADSR) Amplitude(t Seconds) Volts {
+func (adsr *ADSR) Amplitude(t Seconds) Volts {
 	localT := LocalSeconds(t - adsr.T0)
-	var a Volts
 	switch {
-	case localT < LocalSeconds(adsr.Ta):
-		a = Volts(localT / LocalSeconds(adsr.Ta))
-	case localT < adsr.sStart:
-		a = 1 - Volts((localT-LocalSeconds(adsr.Ta))*(1-LocalSeconds(adsr.Ls))/LocalSeconds(adsr.Td))
-	case localT < adsr.releaseAt:
-		a = adsr.Ls
-	case localT > adsr.releaseAt:
-		if !adsr.knowRelease {
-			fmt.Printf("ADSR envelope error: in release stage of unreleased envelope")
+	case localT < 0:
+		return 0
+	case adsr.knowRelease && localT >= adsr.releaseAt:
+		if adsr.Tr < PlanckTime {
+			return 0
+		}
+		a := adsr.held(adsr.releaseAt) * (1 - Volts((localT-adsr.releaseAt)/LocalSeconds(adsr.Tr)))
+		if a < 0 {
+			return 0
 		}
-	default:
-		fmt.Printf("ADSR envelope error: in unknown portion of envelope")
+		return a
 	}
-	return a
+	return adsr.held(localT)
+}
+
+// held is the level of the envelope at local time t, assuming the note is still held down
+func (adsr *ADSR) held(localT LocalSeconds) Volts {
+	tAttack := LocalSeconds(adsr.Tdl)
+	tHold := tAttack + LocalSeconds(adsr.Ta)
+	tDecay := tHold + LocalSeconds(adsr.Th)
+	switch {
+	case localT < tAttack:
+		return 0
+	case localT < tHold:
+		return Volts((localT - tAttack) / LocalSeconds(adsr.Ta))
+	case localT < tDecay:
+		return 1
+	case localT < adsr.sStart:
+		return 1 - Volts((localT-tDecay)*(1-LocalSeconds(adsr.Ls))/LocalSeconds(adsr.Td))
+	}
+	return adsr.Ls
+}
+
+// Length is the whole duration of the envelope, or MaxNoteLen if it has not been released yet
+func (adsr *ADSR) Length() Seconds {
+	if !adsr.knowRelease {
+		return MaxNoteLen
+	}
+	return Seconds(adsr.releaseAt) + adsr.Tr
 }
 
 func max(a, b Seconds) Seconds {
@@ -163,8 +245,46 @@ func NewGaussian(globalT Seconds, λ Seconds, reps bool, l Seconds, newμ, newσ
 	return g
 }
 
+// Amplitude is, repeating every λ if that is set
+func (g *Gaussian) Amplitude(t Seconds) Volts {
+	localT := t - g.T0
+	if g.λ > PlanckTime {
+		localT = Seconds(math.Mod(float64(localT), float64(g.λ)))
+	}
+	return g.onePeriodAmplitude(localT)
+}
+
 // OnePeriodAmplitude fulfils Envelope interface
 func (g *Gaussian) onePeriodAmplitude(localT Seconds) Volts {
 	xu := float64(localT - g.μ)
 	return Volts(math.Exp(-xu * xu / float64(2*g.σσ)))
 }
+
+// Length is
+func (g *Gaussian) Length() Seconds {
+	return g.Len
+}
+
+// Hann is a raised cosine bump lasting Len, a smooth window for grains and crossfades
+type Hann struct {
+	Envelope
+}
+
+// NewHann makes one
+func NewHann(t Seconds, l Seconds) *Hann {
+	return &Hann{Envelope: Envelope{T0: t, Len: l}}
+}
+
+// Amplitude is
+func (h *Hann) Amplitude(t Seconds) Volts {
+	localT := t - h.T0
+	if localT < 0 || localT > h.Len {
+		return 0
+	}
+	return Volts(0.5 - 0.5*math.Cos(τ*float64(localT/h.Len)))
+}
+
+// Length is
+func (h *Hann) Length() Seconds {
+	return h.Len
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+// ███████╗██╗  ██╗██████╗ ██████╗
+// ██╔════╝╚██╗██╔╝██╔══██╗██╔══██╗
+// █████╗   ╚███╔╝ ██████╔╝██████╔╝
+// ██╔══╝   ██╔██╗ ██╔═══╝ ██╔══██╗
+// ███████╗██╔╝ ██╗██║     ██║  ██║
+// ╚══════╝╚═╝  ╚═╝╚═╝     ╚═╝  ╚═╝
+
+// Waveforms can be written as expressions in the angle a, e.g.
+//
+//   sin(a) + 0.3*sin(3*a) - 0.1*sq(a)
+//
+// with + - * / % ^ (power), brackets, numbers, the constants π (pi), τ (tau) and e, and the functions in
+// exprFuncs. Any other name is a parameter, 0 until set or bound to a modulation source. An expression
+// is compiled once into closures; with no parameters bound it can also be tabulated, one cycle sampled
+// into a wavetable, which is faster to play.
+
+// WaveTableSize is how many points a cycle is tabulated into, unless asked otherwise
+const WaveTableSize = 2048
+
+// WaveError is a mistake in a wave expression, at a rune position (from 1)
+type WaveError struct {
+	Src string
+	Pos int
+	Msg string
+}
+
+func (we *WaveError) Error() string {
+	return fmt.Sprintf("wave expression: col %d: %s", we.Pos, we.Msg)
+}
+
+// exprFunc is a function expressions can call
+type exprFunc struct {
+	args int
+	f    func(x []float64) float64
+}
+
+// waveFunc is a Waveform as a function of float64s
+func waveFunc(w Waveform) func(x []float64) float64 {
+	return func(x []float64) float64 { return float64(w(Angle(x[0]))) }
+}
+
+// exprFuncs are the functions expressions can call
+var exprFuncs = map[string]exprFunc{
+	"sin":   {1, func(x []float64) float64 { return math.Sin(x[0]) }},
+	"cos":   {1, func(x []float64) float64 { return math.Cos(x[0]) }},
+	"tan":   {1, func(x []float64) float64 { return math.Tan(x[0]) }},
+	"abs":   {1, func(x []float64) float64 { return math.Abs(x[0]) }},
+	"sqrt":  {1, func(x []float64) float64 { return math.Sqrt(x[0]) }},
+	"exp":   {1, func(x []float64) float64 { return math.Exp(x[0]) }},
+	"log":   {1, func(x []float64) float64 { return math.Log(x[0]) }},
+	"floor": {1, func(x []float64) float64 { return math.Floor(x[0]) }},
+	"sign": {1, func(x []float64) float64 {
+		if x[0] == 0 {
+			return 0
+		}
+		return math.Copysign(1, x[0])
+	}},
+	"min":   {2, func(x []float64) float64 { return math.Min(x[0], x[1]) }},
+	"max":   {2, func(x []float64) float64 { return math.Max(x[0], x[1]) }},
+	"pow":   {2, func(x []float64) float64 { return math.Pow(x[0], x[1]) }},
+	"mod":   {2, func(x []float64) float64 { return math.Mod(x[0], x[1]) }},
+	"clamp": {3, func(x []float64) float64 { return math.Max(x[1], math.Min(x[2], x[0])) }},
+	"sq":    {1, waveFunc(SquareWave)},
+	"saw":   {1, waveFunc(SawWave)},
+	"tri":   {1, waveFunc(TriangleWave)},
+	"pulse": {2, func(x []float64) float64 { // pulse(a, width), width 0...1
+		if cycle(Angle(x[0])) < τ*x[1] {
+			return 1
+		}
+		return -1
+	}},
+}
+
+// exprConsts are the names with fixed values
+var exprConsts = map[string]float64{"π": π, "pi": π, "τ": τ, "tau": τ, "e": math.E}
+
+// WaveExpr is a compiled wave expression
+type WaveExpr struct {
+	Src     string
+	names   []string    // Parameters, in the order they first appear
+	vals    []float64   //
+	bound   []ModSource // Source of each parameter, if any
+	eval    exprEval
+	table   []Volts     // One cycle, if tabulated
+	scratch [][]float64 // Arguments of each function call
+}
+
+// exprEval is a compiled (part of an) expression, evaluated at a for the parameters of we
+type exprEval func(we *WaveExpr, a float64) float64
+
+// CompileWave compiles an expression in a
+func CompileWave(src string) (*WaveExpr, error) {
+	we := &WaveExpr{Src: src}
+	p := &exprParser{we: we, src: []rune(src)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	f, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != 0 {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	we.eval = f
+	we.bound = make([]ModSource, len(we.names))
+	return we, nil
+}
+
+// Clone is a copy to be set, bound and tabulated apart from this one, sharing its compiled code
+func (we *WaveExpr) Clone() *WaveExpr {
+	c := *we
+	c.vals = append([]float64(nil), we.vals...)
+	c.bound = append([]ModSource(nil), we.bound...)
+	c.table = append([]Volts(nil), we.table...)
+	c.scratch = make([][]float64, len(we.scratch))
+	for i, x := range we.scratch {
+		c.scratch[i] = make([]float64, len(x))
+	}
+	return &c
+}
+
+// Params are the names of its parameters
+func (we *WaveExpr) Params() []string {
+	return append([]string(nil), we.names...)
+}
+
+// param finds a parameter
+func (we *WaveExpr) param(name string) (int, error) {
+	for i, n := range we.names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("wave expression %q has no parameter %q", we.Src, name)
+}
+
+// Set gives a parameter a value (retabulating if need be)
+func (we *WaveExpr) Set(name string, v float64) error {
+	i, err := we.param(name)
+	if err != nil {
+		return err
+	}
+	we.vals[i] = v
+	if we.table != nil {
+		we.Tabulate(len(we.table))
+	}
+	return nil
+}
+
+// Bind makes a parameter follow a modulation source (see Update); it can no longer be tabulated
+func (we *WaveExpr) Bind(name string, src ModSource) error {
+	i, err := we.param(name)
+	if err != nil {
+		return err
+	}
+	we.bound[i] = src
+	we.table = nil
+	return nil
+}
+
+// Update sets the bound parameters for global time t
+func (we *WaveExpr) Update(t Seconds) {
+	for i, src := range we.bound {
+		if src != nil {
+			we.vals[i] = src.Value(t)
+		}
+	}
+}
+
+// Tabulate samples one cycle into a table of n points, which the Waveform then plays from
+func (we *WaveExpr) Tabulate(n int) *WaveExpr {
+	for _, src := range we.bound {
+		if src != nil {
+			return we // it changes as it plays
+		}
+	}
+	we.table = make([]Volts, n)
+	for i := range we.table {
+		we.table[i] = Volts(we.eval(we, τ*float64(i)/float64(n)))
+	}
+	return we
+}
+
+// Waveform is the expression as a Waveform, from the table if there is one
+func (we *WaveExpr) Waveform() Waveform {
+	return func(a Angle) Volts {
+		if we.table == nil {
+			return Volts(we.eval(we, cycle(a))) // 0...τ, as the table is made
+		}
+		x := cycle(a) / τ * float64(len(we.table))
+		i := int(x)
+		f := Volts(x - float64(i))
+		return we.table[i%len(we.table)]*(1-f) + we.table[(i+1)%len(we.table)]*f
+	}
+}
+
+// WaveOsc is an oscillator playing a wave expression, keeping its bound parameters up to date
+type WaveOsc struct {
+	*Oscillator
+	Expr *WaveExpr
+}
+
+// NewWaveOsc makes one starting at global time t
+func NewWaveOsc(t Seconds, ν Hertz, we *WaveExpr) *WaveOsc {
+	return &WaveOsc{Oscillator: NewWave(t, ν, we.Waveform()), Expr: we}
+}
+
+// Amplitude is
+func (wo *WaveOsc) Amplitude(t Seconds) Volts {
+	wo.Expr.Update(t)
+	return wo.Oscillator.Amplitude(t)
+}
+
+// exprToken is a token of an expression: kind is 0 at the end, 'n' for numbers, 'i' for names, or the
+// operator itself
+type exprToken struct {
+	kind rune
+	pos  int
+	text string
+	num  float64
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case 0:
+		return "end of expression"
+	case 'n', 'i':
+		return fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Sprintf("%q", string(t.kind))
+}
+
+// exprParser is a recursive descent parser, building closures as it goes
+type exprParser struct {
+	we  *WaveExpr
+	src []rune
+	i   int
+	tok exprToken
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return &WaveError{Src: p.we.Src, Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next reads the next token
+func (p *exprParser) next() error {
+	for p.i < len(p.src) && unicode.IsSpace(p.src[p.i]) {
+		p.i++
+	}
+	p.tok = exprToken{pos: p.i + 1}
+	if p.i >= len(p.src) {
+		return nil
+	}
+	start := p.i
+	r := p.src[p.i]
+	switch {
+	case unicode.IsDigit(r) || r == '.':
+		for p.i < len(p.src) && (unicode.IsDigit(p.src[p.i]) || p.src[p.i] == '.') {
+			p.i++
+		}
+		if p.i < len(p.src) && (p.src[p.i] == 'e' || p.src[p.i] == 'E') { // an exponent, if digits follow
+			j := p.i + 1
+			if j < len(p.src) && (p.src[j] == '+' || p.src[j] == '-') {
+				j++
+			}
+			if j < len(p.src) && unicode.IsDigit(p.src[j]) {
+				for p.i = j; p.i < len(p.src) && unicode.IsDigit(p.src[p.i]); p.i++ {
+				}
+			}
+		}
+		p.tok.kind, p.tok.text = 'n', string(p.src[start:p.i])
+		v, err := strconv.ParseFloat(p.tok.text, 64)
+		if err != nil {
+			return p.errorf("bad number %q", p.tok.text)
+		}
+		p.tok.num = v
+	case unicode.IsLetter(r) || r == '_':
+		for p.i < len(p.src) && (unicode.IsLetter(p.src[p.i]) || unicode.IsDigit(p.src[p.i]) || p.src[p.i] == '_') {
+			p.i++
+		}
+		p.tok.kind, p.tok.text = 'i', string(p.src[start:p.i])
+	case r == '+' || r == '-' || r == '*' || r == '/' || r == '%' || r == '^' || r == '(' || r == ')' || r == ',':
+		p.i++
+		p.tok.kind = r
+	default:
+		return p.errorf("unexpected %q", r)
+	}
+	return nil
+}
+
+// expect checks for, and skips, an operator
+func (p *exprParser) expect(kind rune) error {
+	if p.tok.kind != kind {
+		return p.errorf("expected %q, found %s", kind, p.tok)
+	}
+	return p.next()
+}
+
+// sum is terms added or subtracted
+func (p *exprParser) sum() (exprEval, error) {
+	f, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == '+' || p.tok.kind == '-' {
+		op := p.tok.kind
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		g, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l := f
+		if op == '+' {
+			f = func(we *WaveExpr, a float64) float64 { return l(we, a) + g(we, a) }
+		} else {
+			f = func(we *WaveExpr, a float64) float64 { return l(we, a) - g(we, a) }
+		}
+	}
+	return f, nil
+}
+
+// product is factors multiplied, divided or taken modulo
+func (p *exprParser) product() (exprEval, error) {
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == '*' || p.tok.kind == '/' || p.tok.kind == '%' {
+		op := p.tok.kind
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		g, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := f
+		switch op {
+		case '*':
+			f = func(we *WaveExpr, a float64) float64 { return l(we, a) * g(we, a) }
+		case '/':
+			f = func(we *WaveExpr, a float64) float64 { return l(we, a) / g(we, a) }
+		default:
+			f = func(we *WaveExpr, a float64) float64 { return math.Mod(l(we, a), g(we, a)) }
+		}
+	}
+	return f, nil
+}
+
+// unary is a power, perhaps negated
+func (p *exprParser) unary() (exprEval, error) {
+	if p.tok.kind == '-' || p.tok.kind == '+' {
+		neg := p.tok.kind == '-'
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f, err := p.unary()
+		if err != nil || !neg {
+			return f, err
+		}
+		return func(we *WaveExpr, a float64) float64 { return -f(we, a) }, nil
+	}
+	return p.power()
+}
+
+// power is a primary, perhaps raised to a power (right associative, and binding tighter than minus)
+func (p *exprParser) power() (exprEval, error) {
+	f, err := p.primary()
+	if err != nil || p.tok.kind != '^' {
+		return f, err
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	g, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(we *WaveExpr, a float64) float64 { return math.Pow(f(we, a), g(we, a)) }, nil
+}
+
+// primary is a number, name, call or bracketed expression
+func (p *exprParser) primary() (exprEval, error) {
+	tok := p.tok
+	switch tok.kind {
+	case 'n':
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return func(we *WaveExpr, a float64) float64 { return tok.num }, nil
+	case '(':
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(')')
+	case 'i':
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == '(' {
+			return p.call(tok)
+		}
+		if tok.text == "a" {
+			return func(we *WaveExpr, a float64) float64 { return a }, nil
+		}
+		if c, ok := exprConsts[tok.text]; ok {
+			return func(we *WaveExpr, a float64) float64 { return c }, nil
+		}
+		if _, ok := exprFuncs[tok.text]; ok {
+			p.tok = tok
+			return nil, p.errorf("%s is a function, and needs ()", tok.text)
+		}
+		i, err := p.we.param(tok.text)
+		if err != nil { // a new parameter
+			i = len(p.we.names)
+			p.we.names, p.we.vals = append(p.we.names, tok.text), append(p.we.vals, 0)
+		}
+		return func(we *WaveExpr, a float64) float64 { return we.vals[i] }, nil
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// call is a function call, whose name has been read
+func (p *exprParser) call(name exprToken) (exprEval, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		p.tok = name
+		return nil, p.errorf("no function %q", name.text)
+	}
+	open := p.tok
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []exprEval
+	for p.tok.kind != ')' {
+		if len(args) > 0 {
+			if p.tok.kind != ',' {
+				return nil, p.errorf("expected ',' or ')', found %s", p.tok)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		f, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, f)
+	}
+	if len(args) != fn.args {
+		p.tok = open
+		return nil, p.errorf("%s takes %d argument(s), not %d", name.text, fn.args, len(args))
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	k := len(p.we.scratch)
+	p.we.scratch = append(p.we.scratch, make([]float64, len(args)))
+	return func(we *WaveExpr, a float64) float64 {
+		x := we.scratch[k]
+		for i, arg := range args {
+			x[i] = arg(we, a)
+		}
+		return fn.f(x)
+	}, nil
+}
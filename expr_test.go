@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWaveExprEval(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		a    float64
+		want float64
+	}{
+		{"1 + 2*3", 0, 7},
+		{"(1 + 2)*3", 0, 9},
+		{"8 - 2 - 1", 0, 5},
+		{"-2^2", 0, -4},
+		{"2^3^2", 0, 512},
+		{"2^-1", 0, 0.5},
+		{"7 % 4", 0, 3},
+		{"2*3 % 4", 0, 2},
+		{"1e3", 0, 1000},
+		{"1.5e-1", 0, 0.15},
+		{"2*e", 0, 2 * math.E},
+		{"a/2", 3, 1.5},
+		{"max(a, 1) + min(a, 1)", 3, 4},
+		{"clamp(a, -1, 1)", 3, 1},
+		{"sin(π/2)", 0, 1},
+	} {
+		we, err := CompileWave(c.src)
+		if err != nil {
+			t.Errorf("%s: %s", c.src, err)
+			continue
+		}
+		if got := we.eval(we, c.a); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%s at %g is %g, want %g", c.src, c.a, got, c.want)
+		}
+	}
+}
+
+func TestWaveExprErrors(t *testing.T) {
+	for _, c := range []struct {
+		src string
+		col int
+		msg string // Part of the message
+	}{
+		{"2e", 2, "unexpected"},
+		{"1 +", 4, "unexpected end"},
+		{"sin(a", 6, "expected ',' or ')'"},
+		{"max(a)", 4, "max takes 2 argument(s), not 1"},
+		{"sin(a, 2)", 4, "sin takes 1 argument(s), not 2"},
+		{"foo(a)", 1, `no function "foo"`},
+		{"2*sin", 3, "sin is a function"},
+		{"a $ 2", 3, "unexpected '$'"},
+	} {
+		_, err := CompileWave(c.src)
+		werr, ok := err.(*WaveError)
+		if !ok {
+			t.Errorf("%s: got %v, want a WaveError", c.src, err)
+			continue
+		}
+		if werr.Pos != c.col || !strings.Contains(werr.Msg, c.msg) {
+			t.Errorf("%s: got col %d %q, want col %d %q", c.src, werr.Pos, werr.Msg, c.col, c.msg)
+		}
+	}
+}
+
+func TestWaveExprTabulate(t *testing.T) {
+	for _, src := range []string{"sin(a) + 0.3*sin(3*a)", "tri(a)*k", "a/τ"} {
+		we, err := CompileWave(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range we.Params() {
+			we.Set(p, 0.5)
+		}
+		tab := we.Clone().Tabulate(WaveTableSize).Waveform()
+		for i := 0; i < 1000; i++ {
+			a := Angle(τ * float64(i) / 1000)
+			want := we.eval(we, float64(a))
+			if got := float64(tab(a)); math.Abs(got-want) > 0.01 {
+				t.Fatalf("%s at %g is %g tabulated, %g evaluated", src, a, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"math"
+)
+
+// ███████╗██╗██╗     ████████╗███████╗██████╗ ███████╗
+// ██╔════╝██║██║     ╚══██╔══╝██╔════╝██╔══██╗██╔════╝
+// █████╗  ██║██║        ██║   █████╗  ██████╔╝███████╗
+// ██╔══╝  ██║██║        ██║   ██╔══╝  ██╔══██╗╚════██║
+// ██║     ██║███████╗   ██║   ███████╗██║  ██║███████║
+// ╚═╝     ╚═╝╚══════╝   ╚═╝   ╚══════╝╚═╝  ╚═╝╚══════╝
+
+// Filters shape the spectrum of a signal. Unlike oscillators and envelopes they have memory,
+// so they must be fed exactly one sample per tick of the synth, in order.
+
+// ButterworthQ is the Q of a single 2 pole stage with the flattest passband
+const ButterworthQ = 0.7071067811865476
+
+// paramSmoothing is the time constant used to glide filter settings to new values without zipper noise
+const paramSmoothing Seconds = 0.005
+
+// Filterer processes a signal one sample at a time
+type Filterer interface {
+	Filter(x Volts) Volts
+}
+
+// TunableFilter is a filter whose cutoff and resonance can be moved while it runs
+type TunableFilter interface {
+	Filterer
+	SetCutoff(f Hertz)
+	SetQ(q float64)
+}
+
+// FilterType selects the response of a Biquad
+type FilterType int
+
+// Biquad responses, from the RBJ Audio EQ Cookbook
+const (
+	LowPass FilterType = iota
+	HighPass
+	BandPass // Constant 0dB peak gain
+	Notch
+	AllPass
+	LowShelf
+	HighShelf
+	Peaking
+)
+
+// Biquad is a 2 pole, 2 zero filter
+type Biquad struct {
+	Type     FilterType
+	SR       Hertz
+	Cutoff   Hertz   // Target cutoff (or centre) frequency
+	Q        float64 // Target resonance (or shelf slope)
+	GainDB   float64 // Target gain, for shelves and peaking only
+	fc, q, g float64 // Smoothed values currently in use
+	smooth   float64 // One pole smoothing coefficient
+	b0, b1   float64 // Coefficients, normalised by a0
+	b2       float64 //
+	a1, a2   float64 //
+	z1, z2   float64 // State (transposed direct form II)
+}
+
+// NewBiquad makes a filter of the given type running at sample rate sr
+func NewBiquad(kind FilterType, sr Hertz, fc Hertz, q float64) *Biquad {
+	bq := &Biquad{Type: kind, SR: sr, Cutoff: fc, Q: q}
+	bq.fc, bq.q = float64(fc), q
+	bq.smooth = 1 - math.Exp(-1/float64(paramSmoothing*Seconds(sr)))
+	bq.design()
+	return bq
+}
+
+// SetCutoff glides the cutoff to f
+func (bq *Biquad) SetCutoff(f Hertz) {
+	bq.Cutoff = f
+}
+
+// SetQ glides the resonance to q
+func (bq *Biquad) SetQ(q float64) {
+	bq.Q = q
+}
+
+// SetGain glides the gain of a shelf or peaking filter to db
+func (bq *Biquad) SetGain(db float64) {
+	bq.GainDB = db
+}
+
+// design calculates the coefficients for the current (smoothed) settings
+func (bq *Biquad) design() {
+	fc := math.Max(1, math.Min(bq.fc, 0.49*float64(bq.SR)))
+	q := math.Max(bq.q, 0.01)
+	w0 := τ * fc / float64(bq.SR)
+	cosw, sinw := math.Cos(w0), math.Sin(w0)
+	α := sinw / (2 * q)
+	A := math.Pow(10, bq.g/40)
+	sqA := 2 * math.Sqrt(A) * α
+	var b0, b1, b2, a0, a1, a2 float64
+	switch bq.Type {
+	case LowPass:
+		b0, b1, b2 = (1-cosw)/2, 1-cosw, (1-cosw)/2
+		a0, a1, a2 = 1+α, -2*cosw, 1-α
+	case HighPass:
+		b0, b1, b2 = (1+cosw)/2, -(1 + cosw), (1+cosw)/2
+		a0, a1, a2 = 1+α, -2*cosw, 1-α
+	case BandPass:
+		b0, b1, b2 = α, 0, -α
+		a0, a1, a2 = 1+α, -2*cosw, 1-α
+	case Notch:
+		b0, b1, b2 = 1, -2*cosw, 1
+		a0, a1, a2 = 1+α, -2*cosw, 1-α
+	case AllPass:
+		b0, b1, b2 = 1-α, -2*cosw, 1+α
+		a0, a1, a2 = 1+α, -2*cosw, 1-α
+	case Peaking:
+		b0, b1, b2 = 1+α*A, -2*cosw, 1-α*A
+		a0, a1, a2 = 1+α/A, -2*cosw, 1-α/A
+	case LowShelf:
+		b0 = A * ((A + 1) - (A-1)*cosw + sqA)
+		b1 = 2 * A * ((A - 1) - (A+1)*cosw)
+		b2 = A * ((A + 1) - (A-1)*cosw - sqA)
+		a0 = (A + 1) + (A-1)*cosw + sqA
+		a1 = -2 * ((A - 1) + (A+1)*cosw)
+		a2 = (A + 1) + (A-1)*cosw - sqA
+	case HighShelf:
+		b0 = A * ((A + 1) + (A-1)*cosw + sqA)
+		b1 = -2 * A * ((A - 1) + (A+1)*cosw)
+		b2 = A * ((A + 1) + (A-1)*cosw - sqA)
+		a0 = (A + 1) - (A-1)*cosw + sqA
+		a1 = 2 * ((A - 1) - (A+1)*cosw)
+		a2 = (A + 1) - (A-1)*cosw - sqA
+	}
+	bq.b0, bq.b1, bq.b2 = b0/a0, b1/a0, b2/a0
+	bq.a1, bq.a2 = a1/a0, a2/a0
+}
+
+// Filter processes one sample
+func (bq *Biquad) Filter(x Volts) Volts {
+	if bq.fc != float64(bq.Cutoff) || bq.q != bq.Q || bq.g != bq.GainDB { // still gliding
+		bq.fc = glide(bq.fc, float64(bq.Cutoff), bq.smooth)
+		bq.q = glide(bq.q, bq.Q, bq.smooth)
+		bq.g = glide(bq.g, bq.GainDB, bq.smooth)
+		bq.design()
+	}
+	in := float64(x)
+	out := bq.b0*in + bq.z1
+	bq.z1 = bq.b1*in - bq.a1*out + bq.z2
+	bq.z2 = bq.b2*in - bq.a2*out
+	return Volts(out)
+}
+
+// glide moves from towards to by the fraction k, snapping when close enough to stop
+func glide(from, to, k float64) float64 {
+	next := from + k*(to-from)
+	if math.Abs(to-next) < 1e-6*(math.Abs(to)+1e-3) {
+		return to
+	}
+	return next
+}
+
+// Cascade is a chain of filters, one after another
+type Cascade []Filterer
+
+// NewButterworth returns an order n (rounded up to even) Butterworth low or high pass, as a cascade of biquads
+func NewButterworth(kind FilterType, sr Hertz, fc Hertz, n int) Cascade {
+	stages := (n + 1) / 2
+	c := Cascade{}
+	for k := 1; k <= stages; k++ {
+		q := 1 / (2 * math.Cos(float64(2*k-1)*π/float64(4*stages)))
+		c = append(c, NewBiquad(kind, sr, fc, q))
+	}
+	return c
+}
+
+// Filter runs x through every stage
+func (c Cascade) Filter(x Volts) Volts {
+	for _, f := range c {
+		x = f.Filter(x)
+	}
+	return x
+}
+
+// SetCutoff moves the cutoff of every tunable stage
+func (c Cascade) SetCutoff(f Hertz) {
+	for _, s := range c {
+		if t, ok := s.(TunableFilter); ok {
+			t.SetCutoff(f)
+		}
+	}
+}
+
+// SetQ sets the resonance of every tunable stage
+func (c Cascade) SetQ(q float64) {
+	for _, s := range c {
+		if t, ok := s.(TunableFilter); ok {
+			t.SetQ(q)
+		}
+	}
+}
+
+// FilteredOsc is an oscillator passed through filters, so they sit between it and the note's envelope
+type FilteredOsc struct {
+	Src     Osciller
+	Filters Cascade
+	Right   Cascade // If the source is stereo, and these are given, the right side goes through them
+}
+
+// NewFilteredOsc wraps osc with the filters given
+func NewFilteredOsc(osc Osciller, filters ...Filterer) *FilteredOsc {
+	return &FilteredOsc{Src: osc, Filters: filters}
+}
+
+// Amplitude is the filtered output, call once per sample
+func (fo *FilteredOsc) Amplitude(t Seconds) Volts {
+	return fo.Filters.Filter(fo.Src.Amplitude(t))
+}
+
+// AmplitudeLR is the filtered output in stereo, if the source is stereo and there are Right filters
+func (fo *FilteredOsc) AmplitudeLR(t Seconds) (l, r Volts) {
+	so, ok := fo.Src.(StereoOsciller)
+	if !ok || len(fo.Right) == 0 {
+		a := fo.Amplitude(t)
+		return a, a
+	}
+	l, r = so.AmplitudeLR(t)
+	return fo.Filters.Filter(l), fo.Right.Filter(r)
+}
+
+// Effecter processes a block of stereo samples in place, e.g. on the master output of a Synth
+type Effecter interface {
+	Process(samples [][2]float64)
+}
+
+// FilterEffect applies a filter to each channel of a stereo signal
+type FilterEffect struct {
+	L, R Filterer
+}
+
+// NewFilterEffect makes a stereo effect from a pair of identical filters
+func NewFilterEffect(l, r Filterer) *FilterEffect {
+	return &FilterEffect{L: l, R: r}
+}
+
+// Process is
+func (fe *FilterEffect) Process(samples [][2]float64) {
+	for i := range samples {
+		samples[i][0] = float64(fe.L.Filter(Volts(samples[i][0])))
+		samples[i][1] = float64(fe.R.Filter(Volts(samples[i][1])))
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+//  ██████╗ ██╗     ██╗██████╗ ███████╗
+// ██╔════╝ ██║     ██║██╔══██╗██╔════╝
+// ██║  ███╗██║     ██║██║  ██║█████╗
+// ██║   ██║██║     ██║██║  ██║██╔══╝
+// ╚██████╔╝███████╗██║██████╔╝███████╗
+//  ╚═════╝ ╚══════╝╚═╝╚═════╝ ╚══════╝
+
+// Glide (portamento) slides a note's pitch rather than jumping it, and pitch bend pushes it about. Both
+// work by retuning an oscillator each sample: the oscillator integrates its phase, so nothing clicks.
+// A Player turns key presses (from the computer keyboard or a MIDI file) into notes that glide and bend.
+
+// GlideCurve is how the pitch moves during a glide
+type GlideCurve int
+
+// Glide curves
+const (
+	GlidePitch  GlideCurve = iota // Straight in pitch (exponential in frequency), as most synths do
+	GlideLinear                   // Straight in frequency, so it seems to hurry at the end when going up
+)
+
+// TunerFunc lets a function be a Tuner, e.g. to keep an octave offset while retuning
+type TunerFunc func(ν Hertz)
+
+// NewFreq is
+func (tf TunerFunc) NewFreq(ν Hertz) {
+	tf(ν)
+}
+
+// Glider plays an oscillator, retuning it through its Tuner as it glides and bends
+type Glider struct {
+	Osciller
+	Tuner     Tuner      // Retunes the oscillator; if nil the pitch stays put
+	Time      Seconds    // How long each glide takes (constant time)...
+	Rate      float64    // ...unless this is set, in semitones per second (constant rate)
+	Curve     GlideCurve //
+	BendRange float64    // Semitones for a full bend, up or down
+	from, to  Hertz
+	start     Seconds
+	dur       Seconds
+	bend      float64 // -1...+1
+	lastν     Hertz
+}
+
+// NewGlider wraps an oscillator sounding at ν
+func NewGlider(osc Osciller, tn Tuner, ν Hertz) *Glider {
+	return &Glider{Osciller: osc, Tuner: tn, BendRange: 2, from: ν, to: ν}
+}
+
+// FreqAt is the pitch at global time t, before bending
+func (g *Glider) FreqAt(t Seconds) Hertz {
+	if g.dur <= 0 || t >= g.start+g.dur {
+		return g.to
+	}
+	if t <= g.start {
+		return g.from
+	}
+	x := float64((t - g.start) / g.dur)
+	if g.Curve == GlideLinear {
+		return g.from + (g.to-g.from)*Hertz(x)
+	}
+	return g.from * Hertz(math.Pow(float64(g.to/g.from), x))
+}
+
+// GlideTo starts a glide to ν at global time t, from wherever the pitch has got to
+func (g *Glider) GlideTo(t Seconds, ν Hertz) {
+	g.from, g.to, g.start = g.FreqAt(t), ν, t
+	g.dur = g.Time
+	if g.Rate > 0 {
+		g.dur = Seconds(math.Abs(12*math.Log2(float64(ν/g.from))) / g.Rate)
+	}
+}
+
+// Bend sets the pitch bend, -1...+1 (from a wheel), scaled by BendRange
+func (g *Glider) Bend(amount float64) {
+	g.bend = math.Max(-1, math.Min(1, amount))
+}
+
+// Amplitude retunes the oscillator for time t, then plays it
+func (g *Glider) Amplitude(t Seconds) Volts {
+	g.retune(t)
+	return g.Osciller.Amplitude(t)
+}
+
+// AmplitudeLR is the same, in stereo if the oscillator is
+func (g *Glider) AmplitudeLR(t Seconds) (l, r Volts) {
+	so, ok := g.Osciller.(StereoOsciller)
+	if !ok {
+		a := g.Amplitude(t)
+		return a, a
+	}
+	g.retune(t)
+	return so.AmplitudeLR(t)
+}
+
+// retune sets the oscillator's pitch for time t
+func (g *Glider) retune(t Seconds) {
+	if g.Tuner == nil {
+		return
+	}
+	ν := g.FreqAt(t) * Hertz(math.Pow(2, g.bend*g.BendRange/12))
+	if ν != g.lastν {
+		g.Tuner.NewFreq(ν)
+		g.lastν = ν
+	}
+}
+
+// Release passes on to the oscillator
+func (g *Glider) Release(t Seconds) {
+	if r, ok := g.Osciller.(Releaser); ok {
+		r.Release(t)
+	}
+}
+
+// Player is played by key number (MIDI numbering, 60 is middle C), from the keyboard or a MIDI file
+type Player interface {
+	NoteOn(t Seconds, key int, velocity float64) // velocity 0...1
+	NoteOff(t Seconds, key int)
+	PitchBend(t Seconds, amount float64) // -1...+1
+}
+
+// NoteMaker makes a note starting at global time t, and the Tuner that retunes it (nil if it can't be)
+type NoteMaker func(t Seconds, ν Hertz, velocity float64) (*Note, Tuner)
+
+// SineMaker makes the plain sine notes the keyboard always played
+func SineMaker(t Seconds, ν Hertz, velocity float64) (*Note, Tuner) {
+	osc := NewSine(t, ν)
+	return NewNote(t, ν, NewTriangle(t, 0.2, false, 0.2), withVelocity(osc, velocity)), osc
+}
+
+// withVelocity scales an oscillator's level by a velocity
+func withVelocity(osc Osciller, velocity float64) Osciller {
+	if velocity == 1 {
+		return osc
+	}
+	mo := NewModOsc(osc, NewModMatrix())
+	mo.Matrix.Target("level").Base = velocity
+	return mo
+}
+
+// VoiceMaker makes notes from a voice; these don't glide or bend
+func VoiceMaker(v Voicer) NoteMaker {
+	return func(t Seconds, ν Hertz, velocity float64) (*Note, Tuner) {
+		return NewVoiceNote(t, ν, velocity, v), nil
+	}
+}
+
+// KeyPlayer plays notes on a synth. It is polyphonic unless Legato is set, in which case a key pressed
+// while another is held takes over the sounding note (and its oscillator), gliding to the new pitch.
+type KeyPlayer struct {
+	Syn       *Synth
+	Make      NoteMaker
+	Track     string     // Mixer track notes play through
+	Glide     Seconds    // Portamento time (0 for none)...
+	GlideRate float64    // ...or rate, in semitones per second
+	Curve     GlideCurve //
+	BendRange float64    // Semitones
+	Legato    bool       // Monophonic, gliding from held notes without retriggering
+	mu        sync.Mutex
+	held      map[int]*playing // Sounding notes by key, until their key comes up
+	sounding  []*playing       // Everything still making a noise, so bends reach released notes too
+	current   *playing         // The note played last, if its key is still down
+	last      Hertz            // Pitch of the last note, where the next one glides from
+	bend      float64
+}
+
+// playing is a note started by a key
+type playing struct {
+	key   int
+	snd   *Sound
+	glide *Glider
+}
+
+// NewKeyPlayer makes one playing on the main track
+func NewKeyPlayer(syn *Synth, mk NoteMaker) *KeyPlayer {
+	return &KeyPlayer{Syn: syn, Make: mk, Track: MainTrack, BendRange: 2, held: map[int]*playing{}}
+}
+
+// SetMaker changes how its notes are made, from the next one on
+func (kp *KeyPlayer) SetMaker(mk NoteMaker) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.Make = mk
+}
+
+// SetGlide sets the portamento time (0 for none)
+func (kp *KeyPlayer) SetGlide(glide Seconds) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.Glide = glide
+}
+
+// SetLegato turns legato on or off
+func (kp *KeyPlayer) SetLegato(legato bool) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.Legato = legato
+}
+
+// glides is whether portamento is on
+func (kp *KeyPlayer) glides() bool {
+	return kp.Glide > 0 || kp.GlideRate > 0
+}
+
+// NoteOn is
+func (kp *KeyPlayer) NoteOn(t Seconds, key int, velocity float64) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	ν := KeyFreq(key)
+	if kp.Legato && kp.current != nil && kp.current.glide.Tuner != nil { // take over the held note rather than starting another
+		pl, sounding := kp.current, false
+		kp.Syn.Change(func() {
+			if sounding = pl.snd.End > t; sounding {
+				pl.glide.Time, pl.glide.Rate, pl.glide.Curve = kp.Glide, kp.GlideRate, kp.Curve
+				pl.glide.GlideTo(t, ν)
+			}
+		})
+		if sounding {
+			delete(kp.held, pl.key)
+			pl.key = key
+			kp.held[key] = pl
+			kp.last = ν
+			return
+		}
+	}
+	if kp.Legato && kp.current != nil { // it can't be retuned, or has died away, so a new note takes over from it
+		old := kp.current.snd
+		kp.Syn.Change(func() { old.Release(t) })
+		delete(kp.held, kp.current.key)
+		kp.current = nil
+	}
+	n, tn := kp.Make(t, ν, velocity)
+	from := ν
+	if kp.glides() && kp.last > 0 {
+		from = kp.last
+	}
+	g := NewGlider(n.Osc, tn, from)
+	g.Time, g.Rate, g.Curve, g.BendRange = kp.Glide, kp.GlideRate, kp.Curve, kp.BendRange
+	g.Bend(kp.bend)
+	if from != ν {
+		g.GlideTo(t, ν)
+	}
+	n.Osc = g
+	if old, ok := kp.held[key]; ok { // struck again without coming up
+		kp.Syn.Change(func() { old.snd.Release(t) })
+	}
+	pl := &playing{key: key, snd: kp.Syn.AddSoundTo(n, t, kp.Track), glide: g}
+	kp.held[key] = pl
+	kp.current = pl
+	kp.last = ν
+	kp.prune(t)
+	kp.sounding = append(kp.sounding, pl)
+}
+
+// NoteOff is
+func (kp *KeyPlayer) NoteOff(t Seconds, key int) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	pl, ok := kp.held[key]
+	if !ok {
+		return
+	}
+	kp.Syn.Change(func() { pl.snd.Release(t) })
+	delete(kp.held, key)
+	if pl == kp.current {
+		kp.current = nil
+	}
+}
+
+// PitchBend bends every sounding note
+func (kp *KeyPlayer) PitchBend(t Seconds, amount float64) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.bend = amount
+	kp.prune(t)
+	kp.Syn.Change(func() {
+		for _, pl := range kp.sounding {
+			pl.glide.BendRange = kp.BendRange
+			pl.glide.Bend(amount)
+		}
+	})
+}
+
+// prune forgets notes that have finished by t
+func (kp *KeyPlayer) prune(t Seconds) {
+	keep := kp.sounding[:0]
+	for _, pl := range kp.sounding {
+		if pl.snd.End > t {
+			keep = append(keep, pl)
+		}
+	}
+	kp.sounding = keep
+}
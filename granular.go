@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+//  ██████╗ ██████╗  █████╗ ███╗   ██╗██╗   ██╗██╗      █████╗ ██████╗
+// ██╔════╝ ██╔══██╗██╔══██╗████╗  ██║██║   ██║██║     ██╔══██╗██╔══██╗
+// ██║  ███╗██████╔╝███████║██╔██╗ ██║██║   ██║██║     ███████║██████╔╝
+// ██║   ██║██╔══██╗██╔══██║██║╚██╗██║██║   ██║██║     ██╔══██║██╔══██╗
+// ╚██████╔╝██║  ██║██║  ██║██║ ╚████║╚██████╔╝███████╗██║  ██║██║  ██║
+//  ╚═════╝ ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝ ╚═════╝ ╚══════╝╚═╝  ╚═╝╚═╝  ╚═╝
+
+// Granular synthesis builds clouds of sound from many short, windowed snippets (grains) of a source
+
+// MaxGrains is the most grains a Granulator will have sounding at once
+const MaxGrains = 256
+
+// GrainSource is something grains can be cut from
+type GrainSource interface {
+	At(pos float64) (l, r Volts) // Frame at (fractional) position pos
+	Span() (first, last float64) // Frames currently available
+	FrameRate() Hertz            // Frames per second at normal pitch
+}
+
+// LiveBuffer is a ring buffer holding the last few seconds of a synth's output, so it can be granulated
+type LiveBuffer struct {
+	SR      Hertz
+	l, r    []float64
+	written int // Frames written since the start
+}
+
+// NewLiveBuffer makes one holding length seconds at sample rate sr
+func NewLiveBuffer(sr Hertz, length Seconds) *LiveBuffer {
+	n := int(Seconds(sr) * length)
+	return &LiveBuffer{SR: sr, l: make([]float64, n), r: make([]float64, n)}
+}
+
+// Write adds a frame at the head of the buffer
+func (lb *LiveBuffer) Write(l, r Volts) {
+	i := lb.written % len(lb.l)
+	lb.l[i], lb.r[i] = float64(l), float64(r)
+	lb.written++
+}
+
+// Span is the range of frames (counted from the start of recording) still in the buffer
+func (lb *LiveBuffer) Span() (first, last float64) {
+	first = float64(lb.written - len(lb.l))
+	if first < 0 {
+		first = 0
+	}
+	return first, float64(lb.written - 1)
+}
+
+// FrameRate is
+func (lb *LiveBuffer) FrameRate() Hertz {
+	return lb.SR
+}
+
+// At returns the (linearly interpolated) frame at pos, or silence if it is not in the buffer
+func (lb *LiveBuffer) At(pos float64) (l, r Volts) {
+	first, last := lb.Span()
+	if pos < first || pos >= last {
+		return 0, 0
+	}
+	i := int(pos)
+	frac := pos - float64(i)
+	a, b := i%len(lb.l), (i+1)%len(lb.l)
+	l = Volts(lb.l[a] + frac*(lb.l[b]-lb.l[a]))
+	r = Volts(lb.r[a] + frac*(lb.r[b]-lb.r[a]))
+	return l, r
+}
+
+// WindowShape is the envelope given to each grain
+type WindowShape int
+
+// Grain windows
+const (
+	GaussianWindow WindowShape = iota
+	HannWindow
+	TriangleWindow
+)
+
+// grain is one snippet of the source, playing through its window
+type grain struct {
+	start  Seconds   // Global time it began
+	pos    float64   // Frame of the source it began at
+	rate   float64   // Frames per second to read
+	gainL  Volts     // Pan
+	gainR  Volts     //
+	window Enveloper // Shape over its lifetime
+	end    Seconds
+}
+
+// Granulator is an oscillator that sprays grains from a source
+type Granulator struct {
+	Src         GrainSource
+	Density     Hertz       // Grains started per second (on average)
+	Size        Seconds     // Length of each grain
+	Position    float64     // Where in the source grains come from, 0 (oldest) to 1 (newest)
+	PosJitter   float64     // Random spread of the position, as a fraction of the source
+	Pitch       float64     // Transposition of every grain, in semitones
+	PitchSpread float64     // Random spread of the pitch, in semitones
+	PanSpread   float64     // Random spread across the stereo field, 0 (centre) to 1 (hard left/right)
+	Window      WindowShape //
+	Gain        Volts       //
+	grains      []*grain
+	next        Seconds // When to start the next grain
+	rnd         *rand.Rand
+}
+
+// NewGranulator returns a cloud of grains from src, starting at global time t
+func NewGranulator(t Seconds, src GrainSource, density Hertz, size Seconds) *Granulator {
+	return &Granulator{
+		Src:      src,
+		Density:  density,
+		Size:     size,
+		Position: 0.5,
+		Window:   GaussianWindow,
+		Gain:     1,
+		next:     t,
+		rnd:      rand.New(rand.NewSource(int64(t * 1e6))),
+	}
+}
+
+// spread returns a random number in -1...+1
+func (gr *Granulator) spread() float64 {
+	return 2*gr.rnd.Float64() - 1
+}
+
+// spawn starts a new grain at global time t, unless grains have no length (whose windows would be 0/0)
+func (gr *Granulator) spawn(t Seconds) {
+	if gr.Size <= 0 {
+		return
+	}
+	first, last := gr.Src.Span()
+	p := gr.Position + gr.PosJitter*gr.spread()
+	p = math.Max(0, math.Min(1, p))
+	semis := gr.Pitch + gr.PitchSpread*gr.spread()
+	pan := gr.PanSpread * gr.spread() // -1 left ... +1 right
+	g := &grain{
+		start: t,
+		pos:   first + p*(last-first),
+		rate:  float64(gr.Src.FrameRate()) * math.Pow(2, semis/12),
+		gainL: Volts(math.Cos((pan + 1) * π / 4)), // equal power pan
+		gainR: Volts(math.Sin((pan + 1) * π / 4)),
+		end:   t + gr.Size,
+	}
+	switch gr.Window {
+	case HannWindow:
+		g.window = NewHann(t, gr.Size)
+	case TriangleWindow:
+		g.window = NewTriangle(t, gr.Size, false, gr.Size)
+	default:
+		g.window = NewGaussian(t, 0, false, gr.Size, gr.Size/2, gr.Size/6)
+	}
+	gr.grains = append(gr.grains, g)
+}
+
+// AmplitudeLR is the stereo sum of all the grains sounding at global time t
+func (gr *Granulator) AmplitudeLR(t Seconds) (l, r Volts) {
+	if gr.next < t-gr.Size { // don't bother catching up on grains that would be over already
+		gr.next = t - gr.Size
+	}
+	for gr.Density > 0 && t >= gr.next {
+		if len(gr.grains) < MaxGrains {
+			gr.spawn(gr.next)
+		}
+		gr.next += Seconds(gr.rnd.ExpFloat64() / float64(gr.Density)) // Poisson arrivals, no audible regularity
+	}
+	live := gr.grains[:0]
+	for _, g := range gr.grains {
+		if t > g.end {
+			continue
+		}
+		live = append(live, g)
+		w := g.window.Amplitude(t)
+		sl, sr := gr.Src.At(g.pos + float64(t-g.start)*g.rate)
+		l += w * g.gainL * sl
+		r += w * g.gainR * sr
+	}
+	gr.grains = live
+	return gr.Gain * l, gr.Gain * r
+}
+
+// Amplitude is the mono mix of the cloud
+func (gr *Granulator) Amplitude(t Seconds) Volts {
+	l, r := gr.AmplitudeLR(t)
+	return (l + r) / 2
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// ██╗  ██╗ █████╗ ██████╗ ██████╗
+// ██║  ██║██╔══██╗██╔══██╗██╔══██╗
+// ███████║███████║██████╔╝██████╔╝
+// ██╔══██║██╔══██║██╔══██╗██╔═══╝
+// ██║  ██║██║  ██║██║  ██║██║
+// ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═╝╚═╝
+
+// The laser harp, as in Rendez-vous III, is a row of beams, each a note of a scale. Moving the mouse across
+// a beam (or clicking on one) plucks it, and how high up the hand is makes the note brighter, or gives it
+// more vibrato. Beams light up while their notes sound.
+
+// HarpHeight is what the height of the hand in a beam does
+type HarpHeight int
+
+// Harp heights
+const (
+	HeightBrightness HarpHeight = iota // Higher is brighter
+	HeightVibrato                      // Higher wobbles more
+)
+
+// Harp is a row of beams in the window
+type Harp struct {
+	Player Player
+	Rect   sdl.Rect   // Where it is drawn
+	Root   int        // Key of the leftmost beam (which should be in the scale)
+	Beams  int        //
+	Height HarpHeight //
+	keys   []int
+	lit    map[int]bool
+	lastX  int32
+	in     bool // Whether the mouse was last in the harp
+}
+
+// NewHarp makes one of n beams going up a scale from the key root, drawn in r
+func NewHarp(pl Player, r sdl.Rect, root int, n int, sc Scale) *Harp {
+	hp := &Harp{Player: pl, Rect: r, Root: root, Beams: n, lit: map[int]bool{}}
+	hp.SetScale(sc)
+	return hp
+}
+
+// SetScale retunes the beams to a scale (chromatic if it has no notes)
+func (hp *Harp) SetScale(sc Scale) {
+	if len(sc) == 0 {
+		sc = Scales["chromatic"]
+	}
+	hp.keys = hp.keys[:0]
+	for k := hp.Root; len(hp.keys) < hp.Beams && k < 128; k++ {
+		if sc.Has(k, hp.Root) {
+			hp.keys = append(hp.keys, k)
+		}
+	}
+}
+
+// beamX is where beam i is across the window
+func (hp *Harp) beamX(i int) int32 {
+	return hp.Rect.X + int32(2*i+1)*hp.Rect.W/int32(2*len(hp.keys))
+}
+
+// height is how high y is up the beams, 0...1
+func (hp *Harp) height(y int32) float64 {
+	return math.Max(0, math.Min(1, 1-float64(y-hp.Rect.Y)/float64(hp.Rect.H)))
+}
+
+// Pluck plays beam i at global time t, with the hand at y
+func (hp *Harp) Pluck(t Seconds, i int, y int32) {
+	hp.Player.NoteOn(t, hp.keys[i], hp.height(y))
+	hp.Player.NoteOff(t, hp.keys[i]) // a pluck just rings on
+}
+
+// Move follows the mouse, plucking each beam it crosses
+func (hp *Harp) Move(t Seconds, x, y int32) {
+	in := x >= hp.Rect.X && x < hp.Rect.X+hp.Rect.W && y >= hp.Rect.Y && y < hp.Rect.Y+hp.Rect.H
+	if in && hp.in {
+		for i := range hp.keys {
+			if bx := hp.beamX(i); (hp.lastX < bx) != (x < bx) {
+				hp.Pluck(t, i, y)
+			}
+		}
+	}
+	hp.lastX, hp.in = x, in
+}
+
+// Click plucks the beam clicked on, if any, saying whether it was one
+func (hp *Harp) Click(t Seconds, x, y int32) bool {
+	if y < hp.Rect.Y || y >= hp.Rect.Y+hp.Rect.H || len(hp.keys) == 0 {
+		return false
+	}
+	reach := hp.Rect.W / int32(4*len(hp.keys))
+	for i := range hp.keys {
+		if bx := hp.beamX(i); x >= bx-reach && x <= bx+reach {
+			hp.Pluck(t, i, y)
+			return true
+		}
+	}
+	return false
+}
+
+// Light sets the keys sounding, saying whether that changed any beam
+func (hp *Harp) Light(keys []int) bool {
+	lit := map[int]bool{}
+	for _, k := range keys {
+		lit[k] = true
+	}
+	changed := false
+	for _, k := range hp.keys {
+		if lit[k] != hp.lit[k] {
+			changed = true
+		}
+	}
+	hp.lit = lit
+	return changed
+}
+
+// Draw draws it on a surface
+func (hp *Harp) Draw(s *sdl.Surface) {
+	s.FillRect(&hp.Rect, sdl.MapRGB(s.Format, 0, 0, 0))
+	for i, k := range hp.keys {
+		w, c := int32(2), sdl.MapRGB(s.Format, 0, 90, 30)
+		if hp.lit[k] {
+			w, c = 6, sdl.MapRGB(s.Format, 120, 255, 120)
+		}
+		r := sdl.Rect{X: hp.beamX(i) - w/2, Y: hp.Rect.Y, W: w, H: hp.Rect.H}
+		s.FillRect(&r, c)
+	}
+}
+
+// Maker makes its plucked notes, which take the height of the hand where a player passes velocity
+func (hp *Harp) Maker() NoteMaker {
+	return func(t Seconds, ν Hertz, height float64) (*Note, Tuner) {
+		env := NewADSR(t, false, 0.005, 1.5, 0, 0.05, 0, 0, PlanckTime*2)
+		mix := 0.3
+		if hp.Height == HeightBrightness {
+			mix = height
+		}
+		cf := NewCrossfade(NewSine(t, ν), NewWave(t, ν, SawWave), mix)
+		mm := NewModMatrix()
+		osc := NewModOsc(cf, mm)
+		mm.Target("level").Base = 0.7
+		if hp.Height == HeightBrightness {
+			return NewNote(t, ν, env, osc), cf
+		}
+		pitch := mm.AddExpTarget("pitch", float64(ν), func(v float64) { cf.NewFreq(Hertz(v)) })
+		mm.Route(NewLFO(LFOSine, 5.5), "pitch", height/24) // up to half a semitone each way
+		return NewNote(t, ν, env, osc), TunerFunc(func(ν Hertz) { pitch.Base = float64(ν) })
+	}
+}
+
+// String is the harp's range and what height does, for display
+func (hp *Harp) String() string {
+	h := "brightness"
+	if hp.Height == HeightVibrato {
+		h = "vibrato"
+	}
+	if len(hp.keys) == 0 {
+		return "Harp"
+	}
+	return fmt.Sprintf("Harp %s-%s  Height: %s", KeyName(hp.keys[0]), KeyName(hp.keys[len(hp.keys)-1]), h)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// ██╗  ██╗███████╗██╗   ██╗██████╗  ██████╗  █████╗ ██████╗ ██████╗
+// ██║ ██╔╝██╔════╝╚██╗ ██╔╝██╔══██╗██╔═══██╗██╔══██╗██╔══██╗██╔══██╗
+// █████╔╝ █████╗   ╚████╔╝ ██████╔╝██║   ██║███████║██████╔╝██║  ██║
+// ██╔═██╗ ██╔══╝    ╚██╔╝  ██╔══██╗██║   ██║██╔══██║██╔══██╗██║  ██║
+// ██║  ██╗███████╗   ██║   ██████╔╝╚██████╔╝██║  ██║██║  ██║██████╔╝
+// ╚═╝  ╚═╝╚══════╝   ╚═╝   ╚═════╝  ╚═════╝ ╚═╝  ╚═╝╚═╝  ╚═╝╚═════╝
+
+// The computer keyboard is played like a piano, as in trackers: the bottom two rows are an octave and a
+// bit (Z S X D C V G B H N J M is C C# D D# E F F# G G# A A# B), and the two rows above them the octave
+// after. Keys are named as SDL names them ("Z", "2", ",", "Left", "F5"...), and a key map file can move
+// any of them, e.g. for other layouts (see keymaps/).
+
+// KeyMap says what each key does
+type KeyMap struct {
+	Notes         map[string]int     `json:"notes"`         // Semitones above the C of the current octave
+	OctaveDown    string             `json:"octaveDown"`    //
+	OctaveUp      string             `json:"octaveUp"`      //
+	TransposeDown string             `json:"transposeDown"` // A semitone
+	TransposeUp   string             `json:"transposeUp"`   //
+	Sustain       string             `json:"sustain"`       // Held, keeps notes sounding after their keys come up
+	Velocity      map[string]float64 `json:"velocity"`      // Keys setting the velocity of notes after, 0...1
+}
+
+// DefaultKeyMap is the QWERTY layout
+func DefaultKeyMap() *KeyMap {
+	km := &KeyMap{
+		Notes:      map[string]int{},
+		OctaveDown: "Left", OctaveUp: "Right",
+		TransposeDown: "PageDown", TransposeUp: "PageUp",
+		Sustain:  "Space",
+		Velocity: map[string]float64{"F5": 0.25, "F6": 0.5, "F7": 0.75, "F8": 1},
+	}
+	for i, k := range []string{"Z", "S", "X", "D", "C", "V", "G", "B", "H", "N", "J", "M", ",", "L", ".", ";", "/"} {
+		km.Notes[k] = i
+	}
+	for i, k := range []string{"Q", "2", "W", "3", "E", "R", "5", "T", "6", "Y", "7", "U", "I", "9", "O", "0", "P", "[", "=", "]"} {
+		km.Notes[k] = 12 + i
+	}
+	return km
+}
+
+// LoadKeyMap reads a key map file; anything it leaves out is as in the default
+func LoadKeyMap(path string) (*KeyMap, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("key map: %w", err)
+	}
+	km := &KeyMap{}
+	if err := json.Unmarshal(b, km); err != nil {
+		return nil, fmt.Errorf("key map %s: %w", path, err)
+	}
+	def := DefaultKeyMap()
+	if km.Notes == nil {
+		km.Notes = def.Notes
+	}
+	if km.Velocity == nil {
+		km.Velocity = def.Velocity
+	}
+	got := []*string{&km.OctaveDown, &km.OctaveUp, &km.TransposeDown, &km.TransposeUp, &km.Sustain}
+	for i, d := range []string{def.OctaveDown, def.OctaveUp, def.TransposeDown, def.TransposeUp, def.Sustain} {
+		if *got[i] == "" {
+			*got[i] = d
+		}
+	}
+	return km, nil
+}
+
+// keyAction is what a key does: plays a note, or one of these
+type keyAction int
+
+// Key actions
+const (
+	keyNote keyAction = iota
+	keyOctaveDown
+	keyOctaveUp
+	keyTransposeDown
+	keyTransposeUp
+	keySustain
+	keyVelocity
+)
+
+// keyUse is a key's action, and its note or velocity
+type keyUse struct {
+	action keyAction
+	note   int
+	vel    float64
+}
+
+// Keyboard plays a Player from the computer keyboard
+type Keyboard struct {
+	Player    Player
+	Octave    int     // Of the bottom row, 4 being middle C's
+	Transpose int     // Semitones
+	Velocity  float64 // Of notes played
+	uses      map[sdl.Keycode]keyUse
+	down      map[sdl.Keycode]int // Keys down, and the note each is playing
+	sustain   bool
+	sustained map[int]bool // Notes whose keys have come up while sustain is held
+}
+
+// NewKeyboard makes one from a key map, checking every key has a name SDL knows and is used only once
+func NewKeyboard(km *KeyMap, pl Player) (*Keyboard, error) {
+	kb := &Keyboard{Player: pl, Octave: 4, Velocity: 0.75,
+		uses: map[sdl.Keycode]keyUse{}, down: map[sdl.Keycode]int{}, sustained: map[int]bool{}}
+	add := func(name string, u keyUse) error {
+		k := sdl.GetKeyFromName(name)
+		if k == sdl.K_UNKNOWN {
+			return fmt.Errorf("key map: no key called %q", name)
+		}
+		if _, dup := kb.uses[k]; dup {
+			return fmt.Errorf("key map: %q is used twice", name)
+		}
+		kb.uses[k] = u
+		return nil
+	}
+	var names []string // in order, so errors are always the same
+	for name := range km.Notes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := add(name, keyUse{action: keyNote, note: km.Notes[name]}); err != nil {
+			return nil, err
+		}
+	}
+	names = names[:0]
+	for name := range km.Velocity {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := add(name, keyUse{action: keyVelocity, vel: km.Velocity[name]}); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range []struct {
+		name   string
+		action keyAction
+	}{
+		{km.OctaveDown, keyOctaveDown}, {km.OctaveUp, keyOctaveUp},
+		{km.TransposeDown, keyTransposeDown}, {km.TransposeUp, keyTransposeUp}, {km.Sustain, keySustain},
+	} {
+		if err := add(c.name, keyUse{action: c.action}); err != nil {
+			return nil, err
+		}
+	}
+	return kb, nil
+}
+
+// Key is the note a key plays now, if it plays one
+func (kb *Keyboard) Key(k sdl.Keycode) (int, bool) {
+	u, ok := kb.uses[k]
+	if !ok || u.action != keyNote {
+		return 0, false
+	}
+	return 12*(kb.Octave+1) + kb.Transpose + u.note, true
+}
+
+// KeyDown handles a key going down at global time t, saying whether it was one of the keyboard's
+func (kb *Keyboard) KeyDown(t Seconds, k sdl.Keycode, repeat bool) bool {
+	u, ok := kb.uses[k]
+	if !ok {
+		return false
+	}
+	if repeat {
+		return true
+	}
+	switch u.action {
+	case keyNote:
+		note, _ := kb.Key(k)
+		if note < 0 || note > 127 {
+			return true
+		}
+		kb.down[k] = note
+		delete(kb.sustained, note)
+		kb.Player.NoteOn(t, note, kb.Velocity)
+	case keyOctaveDown:
+		if kb.Octave > -1 {
+			kb.Octave--
+		}
+	case keyOctaveUp:
+		if kb.Octave < 8 {
+			kb.Octave++
+		}
+	case keyTransposeDown:
+		if kb.Transpose > -12 {
+			kb.Transpose--
+		}
+	case keyTransposeUp:
+		if kb.Transpose < 12 {
+			kb.Transpose++
+		}
+	case keySustain:
+		kb.sustain = true
+	case keyVelocity:
+		kb.Velocity = u.vel
+	}
+	return true
+}
+
+// KeyUp handles a key coming up at global time t, releasing its note (unless sustained)
+func (kb *Keyboard) KeyUp(t Seconds, k sdl.Keycode) bool {
+	u, ok := kb.uses[k]
+	if !ok {
+		return false
+	}
+	switch u.action {
+	case keyNote:
+		note, ok := kb.down[k] // it may have been played before an octave change
+		if !ok {
+			return true
+		}
+		delete(kb.down, k)
+		if kb.sustain {
+			kb.sustained[note] = true
+			return true
+		}
+		if !kb.held(note) {
+			kb.Player.NoteOff(t, note)
+		}
+	case keySustain:
+		kb.sustain = false
+		for note := range kb.sustained {
+			if !kb.held(note) {
+				kb.Player.NoteOff(t, note)
+			}
+		}
+		kb.sustained = map[int]bool{}
+	}
+	return true
+}
+
+// held is whether a key down is playing a note (two keys can play the same one)
+func (kb *Keyboard) held(note int) bool {
+	for _, n := range kb.down {
+		if n == note {
+			return true
+		}
+	}
+	return false
+}
+
+// String is the keyboard's state, for display
+func (kb *Keyboard) String() string {
+	s := "off"
+	if kb.sustain {
+		s = "on"
+	}
+	return fmt.Sprintf("Octave %d  Transpose %+d  Velocity %.2f  Sustain %s", kb.Octave, kb.Transpose, kb.Velocity, s)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image/color"
 	"math"
+	"os"
 	"strings"
 	"time"
 
@@ -101,8 +102,86 @@ func main() {
 	textAt(font, green, black, mainSurf, 2, 32, "JMJ too")
 	window.UpdateSurface()
 
-	lowRowIn := "zxcvbnm"
-	lowRowOut := "ABCDEFG"
+	// a voice can be given by name, from a patch in PatchDir, a MIDI file to play with F4, and a key map
+	var voice *Voice
+	var song []MIDIEvent
+	keyMap := DefaultKeyMap()
+	for _, arg := range os.Args[1:] {
+		switch {
+		case strings.HasSuffix(strings.ToLower(arg), ".mid"):
+			song, err = LoadMIDI(arg)
+		case strings.HasSuffix(strings.ToLower(arg), ".json"):
+			keyMap, err = LoadKeyMap(arg)
+		default:
+			voice, err = LoadVoice(arg, SR)
+		}
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+	}
+	var stopSong chan struct{}
+
+	// keys play through a player, which glides (F1) and does legato (F2); up and down arrows bend,
+	// and F3 steps from polyphonic to mono with last, lowest and highest note priority
+	poly := NewKeyPlayer(mySyn, SineMaker)
+	mono := NewMonoPlayer(mySyn, SineMaker, LastNote)
+	if voice != nil {
+		poly.SetMaker(VoiceMaker(voice))
+		mono.SetMaker(VoiceMaker(voice))
+	}
+	var player Player = poly
+	mode := 0 // poly, then mono with each priority
+	glide, legato := Seconds(0), false
+	keyboard, err := NewKeyboard(keyMap, player)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	textAt(font, green, black, mainSurf, 2, 152, keyboard.String())
+
+	// the piano lights up whatever is sounding, and plays with the mouse; the wheel scrolls it
+	piano := NewPiano(player, sdl.Rect{X: 10, Y: 400, W: 780, H: 180}, 48, 4)
+	var lastLit Seconds
+
+	// F12 swaps the piano for a laser harp, plucked by moving across its beams or clicking them; the higher
+	// the hand, the brighter the note, or (after turning the wheel up; down goes back) the more vibrato
+	harpPlayer := NewKeyPlayer(mySyn, SineMaker)
+	harp := NewHarp(harpPlayer, piano.Rect, 48, 16, Scales["pentatonic"])
+	harpPlayer.Make = harp.Maker()
+	harpOn := false
+	showBoard := func() {
+		var board fmt.Stringer = piano
+		if harpOn {
+			harp.Draw(mainSurf)
+			board = harp
+		} else {
+			piano.Draw(mainSurf)
+		}
+		textAt(font, green, black, mainSurf, 2, 362, fmt.Sprintf("%-40s", board))
+	}
+	showBoard()
+
+	// F9 swaps the mouse over to a theremin: across is pitch and up is louder, while a button is held;
+	// the wheel changes timbre, F10 switches log and linear pitch, and F11 snaps to a scale (and tunes the harp)
+	var theremin *Theremin
+	var thereminSnd *Sound
+	pitchMap, scaleNo := PitchLog, 0
+	scaleNames := []string{"", "chromatic", "major", "minor", "pentatonic", "blues"}
+	showTheremin := func() {
+		status := "Theremin off"
+		if theremin != nil {
+			status = theremin.String() + "  " + scaleNames[scaleNo]
+		}
+		textAt(font, green, black, mainSurf, 2, 182, fmt.Sprintf("%-62s", status))
+	}
+
+	// presets are stepped through with Tab; until one is chosen, keys play a plain sine
+	presets, errs := LoadPresets(PresetDir)
+	for _, err := range errs {
+		fmt.Printf("Error: %s\n", err)
+	}
+	presetNo := -1
 
 	running := true
 	mySyn.recordIt = true
@@ -116,56 +195,177 @@ RunLoop:
 			case *sdl.MouseMotionEvent:
 				// fmt.Printf("[%d ms] MouseMotion\ttype:%d\tid:%d\tx:%d\ty:%d\txrel:%d\tyrel:%d\n",
 				// 	t.Timestamp, t.Type, t.Which, t.X, t.Y, t.XRel, t.YRel)
+				if theremin != nil {
+					theremin.Move(float64(t.X)/float64(mainSurf.W), 1-float64(t.Y)/float64(mainSurf.H))
+					showTheremin()
+				} else if harpOn {
+					harp.Move(mySyn.Now(), t.X, t.Y)
+				} else if t.State&sdl.BUTTON_LMASK != 0 {
+					piano.MouseMove(mySyn.Now(), t.X, t.Y)
+				}
 			case *sdl.MouseButtonEvent:
 				// fmt.Printf("[%d ms] MouseButton\ttype:%d\tid:%d\tx:%d\ty:%d\tbutton:%d\tstate:%d\n",
 				// 	t.Timestamp, t.Type, t.Which, t.X, t.Y, t.Button, t.State)
+				if theremin != nil {
+					theremin.Gate(t.State == sdl.PRESSED)
+				} else if harpOn {
+					if t.Button == sdl.BUTTON_LEFT && t.State == sdl.PRESSED {
+						harp.Click(mySyn.Now(), t.X, t.Y)
+					}
+				} else if t.Button == sdl.BUTTON_LEFT {
+					if t.State == sdl.PRESSED {
+						piano.MouseDown(mySyn.Now(), t.X, t.Y)
+					} else {
+						piano.MouseUp(mySyn.Now())
+					}
+				}
 			case *sdl.MouseWheelEvent:
 				// fmt.Printf("[%d ms] MouseWheel\ttype:%d\tid:%d\tx:%d\ty:%d\n",
 				// 	t.Timestamp, t.Type, t.Which, t.X, t.Y)
+				if theremin != nil {
+					theremin.Timbre(0.05 * float64(t.Y))
+					showTheremin()
+				} else if harpOn {
+					if t.Y != 0 { // up for vibrato, down for brightness; sideways does nothing
+						harp.Height = HeightBrightness
+						if t.Y > 0 {
+							harp.Height = HeightVibrato
+						}
+						showBoard()
+					}
+				} else if t.Y != 0 {
+					piano.Scroll(int(t.Y))
+					showBoard()
+				}
 			case *sdl.KeyboardEvent:
 				//				typeName := "?"
 				switch t.Type {
 				case 768:
 					//					typeName = "KeyDown"
 					//mySyn.recordIt = true
-					freq := MiddleCfreq
-					c := fmt.Sprintf("%c", t.Keysym.Sym)
-					if c == "q" {
+					if t.Keysym.Sym == sdl.K_TAB && len(presets) > 0 {
+						presetNo = (presetNo + 1) % len(presets)
+						preset := presets[presetNo]
+						poly.SetMaker(preset.Maker(SR))
+						mono.SetMaker(preset.Maker(SR))
+						if err := mySyn.Mixer.Set(MainTrack, func(tr *Track) { tr.Inserts = preset.NewEffects(SR) }); err != nil {
+							fmt.Printf("Error: %s\n", err)
+						}
+						textAt(font, green, black, mainSurf, 2, 92, fmt.Sprintf("Preset: %-30s", preset.Name))
+						break
+					}
+					switch t.Keysym.Sym {
+					case sdl.K_UP:
+						player.PitchBend(mySyn.Now(), 1)
+					case sdl.K_DOWN:
+						player.PitchBend(mySyn.Now(), -1)
+					case sdl.K_ESCAPE:
 						running = false
+						if stopSong != nil {
+							close(stopSong)
+						}
 						mySyn.Graphout()
 						break RunLoop // bail right away
+					case sdl.K_F1, sdl.K_F2, sdl.K_F3:
+						switch {
+						case t.Keysym.Sym == sdl.K_F2:
+							legato = !legato
+						case t.Keysym.Sym == sdl.K_F3:
+							mode = (mode + 1) % 4
+							player = poly
+							if mode > 0 {
+								mono.SetPriority(Priority(mode - 1))
+								player = mono
+							}
+							keyboard.Player, piano.Player = player, player
+						case glide > 0:
+							glide = 0
+						default:
+							glide = 0.15
+						}
+						poly.SetGlide(glide)
+						poly.SetLegato(legato)
+						mono.SetGlide(glide)
+						mono.SetLegato(legato)
+						modes := []string{"poly", "mono last", "mono low", "mono high"}
+						textAt(font, green, black, mainSurf, 2, 122, fmt.Sprintf("Glide: %4.2fs  Legato: %-5v  %-9s", glide, legato, modes[mode]))
+					case sdl.K_F9, sdl.K_F10, sdl.K_F11:
+						now := mySyn.Now()
+						switch {
+						case t.Keysym.Sym == sdl.K_F10:
+							pitchMap = 1 - pitchMap
+						case t.Keysym.Sym == sdl.K_F11:
+							scaleNo = (scaleNo + 1) % len(scaleNames)
+						case theremin != nil:
+							mySyn.Change(func() { thereminSnd.Release(now) })
+							theremin, thereminSnd = nil, nil
+						default:
+							theremin = NewTheremin(now, 110, 1760)
+							thereminSnd = mySyn.AddSound(theremin.Note(), now)
+						}
+						if theremin != nil {
+							theremin.Retune(pitchMap, Scales[scaleNames[scaleNo]])
+						}
+						if t.Keysym.Sym == sdl.K_F11 {
+							harp.SetScale(Scales[scaleNames[scaleNo]])
+							showBoard()
+						}
+						showTheremin()
+					case sdl.K_F12:
+						piano.MouseUp(mySyn.Now())
+						harpOn = !harpOn
+						showBoard()
+					case sdl.K_F4:
+						if stopSong != nil {
+							close(stopSong)
+							stopSong = nil
+						} else if song != nil {
+							stopSong = make(chan struct{})
+							go PlayMIDI(mySyn, song, player, stopSong)
+						}
+					default:
+						globalT := mySyn.Now()
+						if key, ok := keyboard.Key(t.Keysym.Sym); ok && t.Repeat == 0 {
+							fmt.Printf("t: %7.4f | Playing key %d (%f)\n", globalT, key, KeyFreq(key))
+						}
+						if keyboard.KeyDown(globalT, t.Keysym.Sym, t.Repeat != 0) {
+							textAt(font, green, black, mainSurf, 2, 152, keyboard.String())
+						}
 					}
-					p := strings.Index(lowRowIn, c)
-					ns := "?"
-					if p != -1 {
-						ns = lowRowOut[p:p+1] + "4"
-						freq = GetFreq(ns)
-					}
-					globalT := mySyn.Now()
-					fmt.Printf("t: %7.4f | Adding sound %s at %f from key %s (index %d)\n", globalT, ns, freq, c, p)
-					//					fmt.Printf("Keystroke at %f\n", globalT)
-					myOsc := NewSine(globalT, freq)
-					myEnv := NewTriangle(globalT, 0.2, false, 0.2)
-					myNote := NewNote(globalT, freq, myEnv, myOsc)
-					mySyn.AddSound(myNote, globalT)
 				case 769:
 					//					typeName = "KeyUp"
+					if t.Keysym.Sym == sdl.K_UP || t.Keysym.Sym == sdl.K_DOWN {
+						player.PitchBend(mySyn.Now(), 0)
+						break
+					}
+					if keyboard.KeyUp(mySyn.Now(), t.Keysym.Sym) {
+						textAt(font, green, black, mainSurf, 2, 152, keyboard.String())
+					}
 				}
 				// fmt.Printf("[%d ms] Keyboard\ttype: %s (%d)\tsym:%c\tmodifiers:%d\tstate:%d\trepeat:%d\n",
 				// t.Timestamp, typeName, t.Type, t.Keysym.Sym, t.Keysym.Mod, t.State, t.Repeat)
 			default:
 				// fmt.Printf("Unknown event type: %d\n", event)
 			}
-			textAt(font, blue, black, mainSurf, 2, 62, fmt.Sprintf("Sounds: %d", len(mySyn.Sounds)))
+			textAt(font, blue, black, mainSurf, 2, 62, fmt.Sprintf("Sounds: %d", mySyn.SoundCount()))
 			window.UpdateSurface()
 			//	time.Sleep(time.Millisecond)
 		}
+		// notes start and stop without events (from a song, or dying away), so the piano or harp is checked often
+		if now := mySyn.Now(); now-lastLit > 0.03 {
+			lastLit = now
+			keys := mySyn.Sounding(now)
+			if (harpOn && harp.Light(keys)) || (!harpOn && piano.Light(keys)) {
+				showBoard()
+				window.UpdateSurface()
+			}
+		}
 	}
 
 }
 
 // Err satisifies beep.Streamer
-func (syn Synth) Err() error {
+func (syn *Synth) Err() error {
 	return nil
 }
 
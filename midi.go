@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab.com/gomidi/midi/reader"
+)
+
+// ███╗   ███╗██╗██████╗ ██╗
+// ████╗ ████║██║██╔══██╗██║
+// ██╔████╔██║██║██║  ██║██║
+// ██║╚██╔╝██║██║██║  ██║██║
+// ██║ ╚═╝ ██║██║██████╔╝██║
+// ╚═╝     ╚═╝╚═╝╚═════╝ ╚═╝
+
+// MIDI files are read whole into a list of timed events, which PlayMIDI then sends to a Player as the
+// synth's clock reaches them. Controllers go to MIDICC, so they can be used as modulation sources.
+
+// MIDIKind is the sort of a MIDI event
+type MIDIKind int
+
+// MIDI event kinds
+const (
+	MIDINoteOn MIDIKind = iota
+	MIDINoteOff
+	MIDIBend
+	MIDIControl
+)
+
+// MIDIEvent is one event from a file, at a time from its start
+type MIDIEvent struct {
+	T        Seconds
+	Kind     MIDIKind
+	Channel  int
+	Key      int     // Or controller number
+	Velocity float64 // 0...1
+	Bend     float64 // -1...+1
+	Value    int     // Controller value, 0...127
+}
+
+// LoadMIDI reads a standard MIDI file into events in time order (tempo changes are allowed for)
+func LoadMIDI(path string) ([]MIDIEvent, error) {
+	var evs []MIDIEvent
+	var ticks []uint64
+	add := func(p *reader.Position, ev MIDIEvent) {
+		evs = append(evs, ev)
+		ticks = append(ticks, p.AbsoluteTicks)
+	}
+	rd := reader.New(reader.NoLogger(),
+		reader.NoteOn(func(p *reader.Position, ch, key, vel uint8) {
+			kind := MIDINoteOn
+			if vel == 0 {
+				kind = MIDINoteOff
+			}
+			add(p, MIDIEvent{Kind: kind, Channel: int(ch), Key: int(key), Velocity: float64(vel) / 127})
+		}),
+		reader.NoteOff(func(p *reader.Position, ch, key, vel uint8) {
+			add(p, MIDIEvent{Kind: MIDINoteOff, Channel: int(ch), Key: int(key)})
+		}),
+		reader.Pitchbend(func(p *reader.Position, ch uint8, value int16) {
+			add(p, MIDIEvent{Kind: MIDIBend, Channel: int(ch), Bend: float64(value) / 8192})
+		}),
+		reader.ControlChange(func(p *reader.Position, ch, cc, value uint8) {
+			add(p, MIDIEvent{Kind: MIDIControl, Channel: int(ch), Key: int(cc), Value: int(value)})
+		}),
+	)
+	if err := reader.ReadSMFFile(rd, path); err != nil {
+		return nil, fmt.Errorf("midi: reading %s: %w", path, err)
+	}
+	// times are worked out once the whole file (and so every tempo change) has been read
+	for i := range evs {
+		if d := reader.TimeAt(rd, ticks[i]); d != nil {
+			evs[i].T = Seconds(d.Seconds())
+		}
+	}
+	sort.SliceStable(evs, func(i, j int) bool { return evs[i].T < evs[j].T })
+	return evs, nil
+}
+
+// PlayMIDI sends events to a player in real time, starting now on the synth's clock; it returns when
+// they are done, or stop is closed (stop may be nil)
+func PlayMIDI(syn *Synth, evs []MIDIEvent, pl Player, stop <-chan struct{}) {
+	t0 := syn.Now()
+	held := map[int]bool{}
+	defer func() { // don't leave notes hanging if stopped early
+		for key := range held {
+			pl.NoteOff(syn.Now(), key)
+		}
+	}()
+	for _, ev := range evs {
+		if wait := t0 + ev.T - syn.Now(); wait > 0 {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(float64(wait) * float64(time.Second))):
+			}
+		}
+		t := t0 + ev.T
+		switch ev.Kind {
+		case MIDINoteOn:
+			pl.NoteOn(t, ev.Key, ev.Velocity)
+			held[ev.Key] = true
+		case MIDINoteOff:
+			pl.NoteOff(t, ev.Key)
+			delete(held, ev.Key)
+		case MIDIBend:
+			pl.PitchBend(t, ev.Bend)
+		case MIDIControl:
+			MIDICC.Set(ev.Key, ev.Value)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ███╗   ███╗██╗██╗  ██╗███████╗██████╗
+// ████╗ ████║██║╚██╗██╔╝██╔════╝██╔══██╗
+// ██╔████╔██║██║ ╚███╔╝ █████╗  ██████╔╝
+// ██║╚██╔╝██║██║ ██╔██╗ ██╔══╝  ██╔══██╗
+// ██║ ╚═╝ ██║██║██╔╝ ██╗███████╗██║  ██║
+// ╚═╝     ╚═╝╚═╝╚═╝  ╚═╝╚══════╝╚═╝  ╚═╝
+
+// The Mixer routes each Sound to a named track. Tracks have inserts, gain, pan, mute and solo, and feed
+// either the master or a group bus, plus any number of aux buses through sends (e.g. a shared reverb).
+// Buses are tracks too, fed by other tracks rather than by sounds. Routing can be changed while playing.
+
+// MainTrack is where sounds go if they don't say otherwise
+const MainTrack = "main"
+
+// Master is the name of the final output, which every track feeds unless routed to a bus
+const Master = "master"
+
+// Send feeds some of a track to a bus
+type Send struct {
+	Bus      string  `json:"bus"`
+	Level    float64 `json:"level"`              // dB
+	PreFader bool    `json:"preFader,omitempty"` // Taken before the track's gain, pan and mute
+}
+
+// Track is one strip of the mixer
+type Track struct {
+	Name    string     `json:"name"`
+	Bus     bool       `json:"bus,omitempty"` // Fed by other tracks, not sounds (solo leaves it alone)
+	Gain    float64    `json:"gain"`          // dB
+	Pan     float64    `json:"pan"`           // -1 (left) ... +1 (right)
+	Mute    bool       `json:"mute,omitempty"`
+	Solo    bool       `json:"solo,omitempty"`
+	Output  string     `json:"output"` // Bus to feed, or Master
+	Sends   []Send     `json:"sends,omitempty"`
+	Inserts []Effecter `json:"-"` // Effects applied before the fader, in order
+	buf     [][2]float64
+}
+
+// Mixer is a set of tracks and buses
+type Mixer struct {
+	MasterGain float64 // dB
+	mu         sync.Mutex
+	tracks     map[string]*Track
+	order      []*Track // Every track before anything it feeds
+}
+
+// NewMixer makes one with just the main track
+func NewMixer() *Mixer {
+	mx := &Mixer{tracks: map[string]*Track{}}
+	mx.AddTrack(MainTrack)
+	return mx
+}
+
+// AddTrack adds (or returns the existing) track fed by sounds
+func (mx *Mixer) AddTrack(name string) *Track {
+	return mx.add(name, false)
+}
+
+// AddBus adds (or returns the existing) bus, fed by other tracks' outputs and sends
+func (mx *Mixer) AddBus(name string) *Track {
+	return mx.add(name, true)
+}
+
+func (mx *Mixer) add(name string, bus bool) *Track {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	if tr, ok := mx.tracks[name]; ok {
+		return tr
+	}
+	tr := &Track{Name: name, Bus: bus, Output: Master}
+	mx.tracks[name] = tr
+	mx.sort()
+	return tr
+}
+
+// RemoveTrack deletes a track; anything routed to it goes to the master instead, and sends to it are dropped
+func (mx *Mixer) RemoveTrack(name string) {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	delete(mx.tracks, name)
+	for _, tr := range mx.tracks {
+		if tr.Output == name {
+			tr.Output = Master
+		}
+		sends := tr.Sends[:0]
+		for _, s := range tr.Sends {
+			if s.Bus != name {
+				sends = append(sends, s)
+			}
+		}
+		tr.Sends = sends
+	}
+	mx.sort()
+}
+
+// Track returns the named track, or nil
+func (mx *Mixer) Track(name string) *Track {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	return mx.tracks[name]
+}
+
+// Tracks lists the tracks in processing order
+func (mx *Mixer) Tracks() []*Track {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	return append([]*Track{}, mx.order...)
+}
+
+// Set changes a track while it may be playing, e.g. mx.Set("drums", func(tr *Track) { tr.Gain = -6 }).
+// New inserts may key sidechains from other tracks, so the order is worked out again.
+func (mx *Mixer) Set(name string, change func(tr *Track)) error {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	tr, ok := mx.tracks[name]
+	if !ok {
+		return fmt.Errorf("mixer: no track %q", name)
+	}
+	was := *tr
+	was.Sends, was.Inserts = append([]Send{}, tr.Sends...), append([]Effecter{}, tr.Inserts...)
+	change(tr)
+	if err := mx.sort(); err != nil {
+		*tr = was
+		mx.sort()
+		return err
+	}
+	return nil
+}
+
+// Route sends the output of a track to a bus (or Master)
+func (mx *Mixer) Route(name string, to string) error {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	tr, ok := mx.tracks[name]
+	if !ok {
+		return fmt.Errorf("mixer: no track %q", name)
+	}
+	if err := mx.checkBus(to); err != nil {
+		return err
+	}
+	was := tr.Output
+	tr.Output = to
+	if err := mx.sort(); err != nil {
+		tr.Output = was
+		mx.sort()
+		return err
+	}
+	return nil
+}
+
+// SetSend sets (or adds) a send from a track to a bus at level dB
+func (mx *Mixer) SetSend(name string, bus string, level float64, preFader bool) error {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	tr, ok := mx.tracks[name]
+	if !ok {
+		return fmt.Errorf("mixer: no track %q", name)
+	}
+	if err := mx.checkBus(bus); err != nil {
+		return err
+	}
+	was := append([]Send{}, tr.Sends...)
+	found := false
+	for i := range tr.Sends {
+		if tr.Sends[i].Bus == bus {
+			tr.Sends[i].Level, tr.Sends[i].PreFader = level, preFader
+			found = true
+		}
+	}
+	if !found {
+		tr.Sends = append(tr.Sends, Send{Bus: bus, Level: level, PreFader: preFader})
+	}
+	if err := mx.sort(); err != nil {
+		tr.Sends = was
+		mx.sort()
+		return err
+	}
+	return nil
+}
+
+// checkBus makes sure a track can feed the named destination
+func (mx *Mixer) checkBus(to string) error {
+	if to == Master {
+		return nil
+	}
+	if bus, ok := mx.tracks[to]; !ok || !bus.Bus {
+		return fmt.Errorf("mixer: no bus %q", to)
+	}
+	return nil
+}
+
+// sort puts the tracks in an order where each comes before everything it feeds, or keys a sidechain of,
+// failing on a loop
+func (mx *Mixer) sort() error {
+	order := []*Track{}
+	state := map[*Track]int{} // 1 visiting, 2 done
+	var visit func(tr *Track) error
+	visit = func(tr *Track) error {
+		switch state[tr] {
+		case 1:
+			return fmt.Errorf("mixer: routing loop through %q", tr.Name)
+		case 2:
+			return nil
+		}
+		state[tr] = 1
+		// everything feeding this track must come first
+		for _, src := range mx.tracks {
+			feeds := src.Output == tr.Name
+			for _, s := range src.Sends {
+				feeds = feeds || s.Bus == tr.Name
+			}
+			for _, tp := range tr.keys() {
+				feeds = feeds || (src != tr && src.taps(tp))
+			}
+			if feeds {
+				if err := visit(src); err != nil {
+					return err
+				}
+			}
+		}
+		state[tr] = 2
+		order = append(order, tr)
+		return nil
+	}
+	for _, name := range sortedNames(mx.tracks) {
+		if err := visit(mx.tracks[name]); err != nil {
+			return err
+		}
+	}
+	mx.order = order
+	return nil
+}
+
+// keys lists the taps the track's inserts take sidechain keys from
+func (tr *Track) keys() []*Tap {
+	var taps []*Tap
+	for _, fx := range tr.Inserts {
+		if dy, ok := fx.(*Dynamics); ok && dy.Sidechain != nil {
+			taps = append(taps, dy.Sidechain)
+		}
+	}
+	return taps
+}
+
+// taps is whether one of the track's inserts is tp
+func (tr *Track) taps(tp *Tap) bool {
+	for _, fx := range tr.Inserts {
+		if fx == Effecter(tp) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedNames gives a stable order to the tracks, so the mix doesn't change from run to run
+func sortedNames(tracks map[string]*Track) []string {
+	names := make([]string, 0, len(tracks))
+	for n := range tracks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dbGain converts dB to a linear gain
+func dbGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// panGains is an equal power pan, unity in the centre
+func panGains(pan float64) (l, r float64) {
+	pan = math.Max(-1, math.Min(1, pan))
+	a := (pan + 1) * π / 4
+	return math.Cos(a) * math.Sqrt2, math.Sin(a) * math.Sqrt2
+}
+
+// Mix renders the sounds playing from global time t0 (one sample every tick) into out
+func (mx *Mixer) Mix(sounds []*Sound, t0 Seconds, tick Seconds, out [][2]float64) {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	n := len(out)
+	solo := false
+	for _, tr := range mx.order {
+		if cap(tr.buf) < n {
+			tr.buf = make([][2]float64, n)
+		}
+		tr.buf = tr.buf[:n]
+		for i := range tr.buf {
+			tr.buf[i] = [2]float64{}
+		}
+		solo = solo || tr.Solo
+	}
+	for i := range out {
+		out[i] = [2]float64{}
+	}
+
+	// sounds into their tracks
+	main := mx.tracks[MainTrack]
+	for _, s := range sounds {
+		tr, ok := mx.tracks[s.Track]
+		if !ok || tr.Bus {
+			tr = main
+		}
+		if tr == nil {
+			continue
+		}
+		for i := range tr.buf {
+			t := t0 + Seconds(i)*tick
+			if s.Start <= t && s.End >= t {
+				l, r := s.AmplitudeLR(t)
+				tr.buf[i][0] += float64(l)
+				tr.buf[i][1] += float64(r)
+			}
+		}
+	}
+
+	// tracks through their strips, into buses or the master
+	for _, tr := range mx.order {
+		for _, fx := range tr.Inserts {
+			fx.Process(tr.buf)
+		}
+		for _, s := range tr.Sends {
+			if s.PreFader {
+				mx.feed(s.Bus, tr.buf, dbGain(s.Level), dbGain(s.Level), out)
+			}
+		}
+		if tr.Mute || (solo && !tr.Solo && !tr.Bus) {
+			continue
+		}
+		pl, pr := panGains(tr.Pan)
+		g := dbGain(tr.Gain)
+		for _, s := range tr.Sends {
+			if !s.PreFader {
+				sg := g * dbGain(s.Level)
+				mx.feed(s.Bus, tr.buf, sg*pl, sg*pr, out)
+			}
+		}
+		mx.feed(tr.Output, tr.buf, g*pl, g*pr, out)
+	}
+	mg := dbGain(mx.MasterGain)
+	for i := range out {
+		out[i][0] *= mg
+		out[i][1] *= mg
+	}
+}
+
+// feed adds buf into the named bus (or out, for the master) with a gain for each side
+func (mx *Mixer) feed(to string, buf [][2]float64, gl, gr float64, out [][2]float64) {
+	dst := out
+	if bus, ok := mx.tracks[to]; ok && to != Master {
+		dst = bus.buf
+	}
+	for i := range buf {
+		dst[i][0] += buf[i][0] * gl
+		dst[i][1] += buf[i][1] * gr
+	}
+}
+
+// MixerConfig is the routing of a mixer, as saved in a session (inserts are not saved)
+type MixerConfig struct {
+	MasterGain float64  `json:"masterGain"`
+	Tracks     []*Track `json:"tracks"`
+}
+
+// Config captures the current routing
+func (mx *Mixer) Config() MixerConfig {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	cfg := MixerConfig{MasterGain: mx.MasterGain}
+	for _, name := range sortedNames(mx.tracks) {
+		tr := *mx.tracks[name]
+		tr.Sends = append([]Send{}, tr.Sends...)
+		cfg.Tracks = append(cfg.Tracks, &tr)
+	}
+	return cfg
+}
+
+// Apply replaces the routing with cfg, keeping the inserts of any tracks that survive
+func (mx *Mixer) Apply(cfg MixerConfig) error {
+	tracks := map[string]*Track{}
+	for _, c := range cfg.Tracks {
+		if c.Name == "" || c.Name == Master {
+			return fmt.Errorf("mixer: bad track name %q", c.Name)
+		}
+		if _, dup := tracks[c.Name]; dup {
+			return fmt.Errorf("mixer: track %q appears twice", c.Name)
+		}
+		tr := *c
+		if tr.Output == "" {
+			tr.Output = Master
+		}
+		tracks[c.Name] = &tr
+	}
+	if _, ok := tracks[MainTrack]; !ok {
+		tracks[MainTrack] = &Track{Name: MainTrack, Output: Master}
+	}
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	old, oldOrder := mx.tracks, mx.order
+	mx.tracks = tracks
+	for name, tr := range tracks {
+		if prev, ok := old[name]; ok {
+			tr.Inserts = prev.Inserts
+		}
+		if err := mx.checkBus(tr.Output); err != nil {
+			mx.tracks, mx.order = old, oldOrder
+			return fmt.Errorf("track %q output: %w", name, err)
+		}
+		for _, s := range tr.Sends {
+			if err := mx.checkBus(s.Bus); err != nil {
+				mx.tracks, mx.order = old, oldOrder
+				return fmt.Errorf("track %q send: %w", name, err)
+			}
+		}
+	}
+	if err := mx.sort(); err != nil {
+		mx.tracks, mx.order = old, oldOrder
+		return err
+	}
+	mx.MasterGain = cfg.MasterGain
+	return nil
+}
+
+// Session is everything about a synth worth saving between runs
+type Session struct {
+	Mixer MixerConfig `json:"mixer"`
+}
+
+// SaveSession writes the synth's session to a JSON file
+func (syn *Synth) SaveSession(path string) error {
+	b, err := json.MarshalIndent(Session{Mixer: syn.Mixer.Config()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// LoadSession restores a session saved by SaveSession
+func (syn *Synth) LoadSession(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var sess Session
+	if err := json.Unmarshal(b, &sess); err != nil {
+		return fmt.Errorf("session %s: %w", path, err)
+	}
+	if err := syn.Mixer.Apply(sess.Mixer); err != nil {
+		return fmt.Errorf("session %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math"
+)
+
+// ███╗   ███╗ ██████╗ ██████╗    ███████╗███████╗███████╗███████╗ ██████╗████████╗███████╗
+// ████╗ ████║██╔═══██╗██╔══██╗   ██╔════╝██╔════╝██╔════╝██╔════╝██╔════╝╚══██╔══╝██╔════╝
+// ██╔████╔██║██║   ██║██║  ██║   █████╗  █████╗  █████╗  █████╗  ██║        ██║   ███████╗
+// ██║╚██╔╝██║██║   ██║██║  ██║   ██╔══╝  ██╔══╝  ██╔══╝  ██╔══╝  ██║        ██║   ╚════██║
+// ██║ ╚═╝ ██║╚██████╔╝██████╔╝   ███████╗██║     ██║     ███████╗╚██████╗   ██║   ███████║
+// ╚═╝     ╚═╝ ╚═════╝ ╚═════╝    ╚══════╝╚═╝     ╚═╝     ╚══════╝ ╚═════╝   ╚═╝   ╚══════╝
+
+// Modulation effects thicken a sound by mixing it with copies whose delay or phase is swept by an LFO.
+// Each has its own LFO, with the right channel's running StereoPhase ahead of the left.
+
+// stereoLFO is a pair of sine LFOs, the right one ahead of the left
+type stereoLFO struct {
+	l, r   *sineLFO
+	rate   Hertz
+	offset Angle
+}
+
+// update follows changes to rate and phase offset without jumping
+func (sl *stereoLFO) update(rate Hertz, sr Hertz, offset Angle) {
+	if sl.l == nil {
+		sl.l, sl.r = newSineLFO(rate, sr, 0), newSineLFO(rate, sr, offset)
+		sl.rate, sl.offset = rate, offset
+		return
+	}
+	if rate != sl.rate {
+		sl.l.step = Angle(τ * float64(rate/sr))
+		sl.r.step = sl.l.step
+		sl.rate = rate
+	}
+	if offset != sl.offset {
+		sl.r.phase = Angle(math.Mod(float64(sl.l.phase+offset), τ))
+		sl.offset = offset
+	}
+}
+
+// next returns both LFO values and moves them on a sample
+func (sl *stereoLFO) next() (l, r float64) {
+	return sl.l.next(), sl.r.next()
+}
+
+// Chorus mixes in several copies of the signal, each delayed by a slowly wobbling amount
+type Chorus struct {
+	SR          Hertz
+	Voices      int     // Number of delayed copies, 1...8
+	Delay       Seconds // Average delay of the copies
+	Depth       Seconds // How far each copy's delay wobbles
+	Rate        Hertz   // How quickly
+	StereoPhase Angle   // Right channel LFO lead
+	Mix         float64 // 0 all dry, 1 all wet
+	lines       [2]*delayLine
+	lfos        []stereoLFO
+}
+
+// NewChorus makes one with some usual settings
+func NewChorus(sr Hertz, voices int) *Chorus {
+	ch := &Chorus{SR: sr, Voices: voices, Delay: 0.02, Depth: 0.004, Rate: 0.8, StereoPhase: π / 2, Mix: 0.5}
+	n := int(0.1 * float64(sr))
+	ch.lines = [2]*delayLine{newDelayLine(n), newDelayLine(n)}
+	return ch
+}
+
+// Process is
+func (ch *Chorus) Process(samples [][2]float64) {
+	voices := ch.Voices
+	if voices < 1 {
+		voices = 1
+	}
+	if voices > 8 {
+		voices = 8
+	}
+	for len(ch.lfos) < voices { // each voice's LFO starts evenly spaced round the cycle
+		v := len(ch.lfos)
+		lfo := stereoLFO{}
+		lfo.update(ch.Rate, ch.SR, ch.StereoPhase)
+		for _, s := range []*sineLFO{lfo.l, lfo.r} {
+			s.phase += Angle(τ * float64(v) / 8)
+		}
+		ch.lfos = append(ch.lfos, lfo)
+	}
+	base := float64(ch.Delay * Seconds(ch.SR))
+	depth := float64(ch.Depth * Seconds(ch.SR))
+	for i := range samples {
+		var wet [2]float64
+		for v := 0; v < voices; v++ {
+			ch.lfos[v].update(ch.Rate, ch.SR, ch.StereoPhase)
+			ml, mr := ch.lfos[v].next()
+			wet[0] += ch.lines[0].read(base + depth*ml)
+			wet[1] += ch.lines[1].read(base + depth*mr)
+		}
+		for c := range wet {
+			in := samples[i][c]
+			ch.lines[c].write(in)
+			samples[i][c] = (1-ch.Mix)*in + ch.Mix*wet[c]/float64(voices)
+		}
+	}
+}
+
+// Flanger mixes the signal with a copy whose very short delay sweeps up and down, with feedback
+type Flanger struct {
+	SR          Hertz
+	Delay       Seconds // Centre of the sweep
+	Depth       Seconds // How far either side of the centre it sweeps
+	Rate        Hertz
+	StereoPhase Angle
+	Feedback    float64 // -1...+1 (exclusive), sharpens the notches
+	ThroughZero bool    // Delay the dry signal by Delay too, so the sweep passes through (and beyond) zero
+	Mix         float64 // 0.5 gives the deepest notches
+	lines       [2]*delayLine
+	lfo         stereoLFO
+	fb          [2]float64
+}
+
+// NewFlanger makes one with some usual settings
+func NewFlanger(sr Hertz) *Flanger {
+	fl := &Flanger{SR: sr, Delay: 0.003, Depth: 0.002, Rate: 0.25, StereoPhase: π / 2, Feedback: 0.5, Mix: 0.5}
+	n := int(0.05 * float64(sr))
+	fl.lines = [2]*delayLine{newDelayLine(n), newDelayLine(n)}
+	return fl
+}
+
+// Process is
+func (fl *Flanger) Process(samples [][2]float64) {
+	fl.lfo.update(fl.Rate, fl.SR, fl.StereoPhase)
+	base := float64(fl.Delay * Seconds(fl.SR))
+	depth := float64(fl.Depth * Seconds(fl.SR))
+	for i := range samples {
+		ml, mr := fl.lfo.next()
+		for c, m := range [2]float64{ml, mr} {
+			in := samples[i][c]
+			fl.lines[c].write(in + fl.Feedback*fl.fb[c])
+			wet := fl.lines[c].read(base + depth*m)
+			fl.fb[c] = wet
+			dry := in
+			if fl.ThroughZero {
+				dry = fl.lines[c].read(base)
+			}
+			samples[i][c] = (1-fl.Mix)*dry + fl.Mix*wet
+		}
+	}
+}
+
+// allpass1 is a first order allpass, shifting phase by 90° at its corner frequency
+type allpass1 struct {
+	z float64
+}
+
+// filter with coefficient a
+func (ap *allpass1) filter(x, a float64) float64 {
+	y := a*x + ap.z
+	ap.z = x - a*y
+	return y
+}
+
+// Phaser sweeps notches through the spectrum with a chain of allpass stages
+type Phaser struct {
+	SR          Hertz
+	Stages      int   // Number of allpass stages (2 per notch), up to 24
+	MinFreq     Hertz // Bottom of the sweep
+	MaxFreq     Hertz // Top of the sweep
+	Rate        Hertz
+	StereoPhase Angle
+	Feedback    float64 // -1...+1 (exclusive), deepens the notches
+	Mix         float64 // 0.5 gives the deepest notches
+	aps         [2][24]allpass1
+	lfo         stereoLFO
+	fb          [2]float64
+}
+
+// NewPhaser makes one with some usual settings
+func NewPhaser(sr Hertz, stages int) *Phaser {
+	return &Phaser{SR: sr, Stages: stages, MinFreq: 200, MaxFreq: 3000, Rate: 0.5, StereoPhase: π / 2, Feedback: 0.3, Mix: 0.5}
+}
+
+// Process is
+func (ph *Phaser) Process(samples [][2]float64) {
+	stages := ph.Stages
+	if stages > len(ph.aps[0]) {
+		stages = len(ph.aps[0])
+	}
+	ph.lfo.update(ph.Rate, ph.SR, ph.StereoPhase)
+	span := math.Log2(float64(ph.MaxFreq / ph.MinFreq))
+	for i := range samples {
+		ml, mr := ph.lfo.next()
+		for c, m := range [2]float64{ml, mr} {
+			f := float64(ph.MinFreq) * math.Pow(2, span*(m+1)/2) // sweep evenly in pitch
+			w := math.Tan(π * math.Min(f, 0.49*float64(ph.SR)) / float64(ph.SR))
+			a := (w - 1) / (w + 1)
+			in := samples[i][c]
+			x := in + ph.Feedback*ph.fb[c]
+			for s := 0; s < stages; s++ {
+				x = ph.aps[c][s].filter(x, a)
+			}
+			ph.fb[c] = x
+			samples[i][c] = (1-ph.Mix)*in + ph.Mix*x
+		}
+	}
+}
+
+// Vibrato wobbles the pitch by sweeping a delay, with no dry signal
+type Vibrato struct {
+	SR          Hertz
+	Rate        Hertz
+	Depth       float64 // Peak pitch deviation, in cents
+	StereoPhase Angle
+	lines       [2]*delayLine
+	lfo         stereoLFO
+}
+
+// NewVibrato makes one
+func NewVibrato(sr Hertz, rate Hertz, cents float64) *Vibrato {
+	n := int(0.1 * float64(sr))
+	return &Vibrato{SR: sr, Rate: rate, Depth: cents, lines: [2]*delayLine{newDelayLine(n), newDelayLine(n)}}
+}
+
+// Process is
+func (vb *Vibrato) Process(samples [][2]float64) {
+	vb.lfo.update(vb.Rate, vb.SR, vb.StereoPhase)
+	// a delay swinging by ±D at rate f bends the pitch by a ratio of about 1±τfD
+	d := 0.0
+	if vb.Rate > 0 {
+		d = (math.Pow(2, vb.Depth/1200) - 1) / (τ * float64(vb.Rate)) * float64(vb.SR)
+	}
+	for i := range samples {
+		ml, mr := vb.lfo.next()
+		for c, m := range [2]float64{ml, mr} {
+			vb.lines[c].write(samples[i][c])
+			samples[i][c] = vb.lines[c].read(1 + d + d*m)
+		}
+	}
+}
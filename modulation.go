@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// ███╗   ███╗ ██████╗ ██████╗ ██╗   ██╗██╗      █████╗ ████████╗██╗ ██████╗ ███╗   ██╗
+// ████╗ ████║██╔═══██╗██╔══██╗██║   ██║██║     ██╔══██╗╚══██╔══╝██║██╔═══██╗████╗  ██║
+// ██╔████╔██║██║   ██║██║  ██║██║   ██║██║     ███████║   ██║   ██║██║   ██║██╔██╗ ██║
+// ██║╚██╔╝██║██║   ██║██║  ██║██║   ██║██║     ██╔══██║   ██║   ██║██║   ██║██║╚██╗██║
+// ██║ ╚═╝ ██║╚██████╔╝██████╔╝╚██████╔╝███████╗██║  ██║   ██║   ██║╚██████╔╝██║ ╚████║
+// ╚═╝     ╚═╝ ╚═════╝ ╚═════╝  ╚═════╝ ╚══════╝╚═╝  ╚═╝   ╚═╝   ╚═╝ ╚═════╝ ╚═╝  ╚═══╝
+
+// Modulation varies parameters as a note plays. Sources (LFOs, envelopes, velocity, key, MIDI CCs) are
+// routed through a ModMatrix to named targets, each of which is just a setter for some numeric parameter.
+// A target's value is its base plus the sum of each source times its depth; pitch-like targets are
+// exponential, so depth is in octaves.
+
+// ModSource is anything giving a modulation value at global time t; LFOs are -1...+1, the rest 0...1
+type ModSource interface {
+	Value(t Seconds) float64
+}
+
+// LFOShape is the waveform of an LFO
+type LFOShape int
+
+// LFO shapes
+const (
+	LFOSine LFOShape = iota
+	LFOTriangle
+	LFOSaw
+	LFOSquare
+	LFOSampleHold   // A new random level each cycle
+	LFOSmoothRandom // Glides between random levels, one per cycle
+)
+
+// LFO is a low frequency oscillator for modulation
+type LFO struct {
+	Shape   LFOShape
+	Rate    Hertz    // Cycles per second, unless synced
+	Sync    Division // If non zero (and Tempo is set), a cycle lasts this division of the Tempo
+	Tempo   *Tempo   //
+	Phase   Angle    // Where in the cycle it starts
+	KeySync bool     // Restart at each Retrigger (i.e. each note), rather than running freely from time 0
+	T0      Seconds  // When it (re)started
+	cycles  float64  // Cycles run since T0
+	lastT   Seconds
+	value   float64
+	ran     bool
+	rnd     *rand.Rand
+	rndA    float64 // Random levels at the start and end of this cycle
+	rndB    float64
+	cycle   int64 // Which cycle the random levels are for
+}
+
+// lfoSeeds counts the LFOs made, so each has random levels of its own (the same from run to run)
+var lfoSeeds int64
+
+// NewLFO makes a free running one
+func NewLFO(shape LFOShape, rate Hertz) *LFO {
+	seed := atomic.AddInt64(&lfoSeeds, 1)
+	lfo := &LFO{Shape: shape, Rate: rate, rnd: rand.New(rand.NewSource(seed)), cycle: -1}
+	lfo.rndB = 2*lfo.rnd.Float64() - 1
+	return lfo
+}
+
+// SyncTo locks the rate to a division of a tempo
+func (lfo *LFO) SyncTo(tp *Tempo, div Division) *LFO {
+	lfo.Tempo, lfo.Sync = tp, div
+	return lfo
+}
+
+// Retrigger restarts a key synced LFO at global time t (free running ones carry on)
+func (lfo *LFO) Retrigger(t Seconds) {
+	if lfo.KeySync {
+		lfo.T0, lfo.lastT, lfo.cycles, lfo.cycle, lfo.ran = t, t, 0, -1, false
+	}
+}
+
+// rate is the current rate, allowing for tempo sync
+func (lfo *LFO) rate() Hertz {
+	if lfo.Sync > 0 && lfo.Tempo != nil && lfo.Tempo.BPM > 0 {
+		return Hertz(1 / lfo.Tempo.Duration(lfo.Sync))
+	}
+	return lfo.Rate
+}
+
+// Value is the LFO's level at global time t. It may be shared, being worked out once for each t.
+func (lfo *LFO) Value(t Seconds) float64 {
+	if t == lfo.lastT && lfo.ran {
+		return lfo.value
+	}
+	lfo.ran = true
+	if t < lfo.T0 {
+		t = lfo.T0
+	}
+	// phase is accumulated, not multiplied out, so the rate can change smoothly
+	if t > lfo.lastT {
+		lfo.cycles += float64((t - lfo.lastT) * Seconds(lfo.rate()))
+	}
+	lfo.lastT = t
+	pos := lfo.cycles + float64(lfo.Phase)/τ
+	n := math.Floor(pos)
+	f := pos - n // 0...1 through the cycle
+	switch lfo.Shape {
+	case LFOSine:
+		lfo.value = math.Sin(τ * f)
+	case LFOTriangle:
+		lfo.value = 1 - 4*math.Abs(math.Mod(f+0.25, 1)-0.5) // from 0, rising, like the sine
+	case LFOSaw:
+		lfo.value = 2*f - 1
+	case LFOSquare:
+		lfo.value = 1
+		if f >= 0.5 {
+			lfo.value = -1
+		}
+	case LFOSampleHold, LFOSmoothRandom:
+		if int64(n)-lfo.cycle > 2 { // skip over a long gap
+			lfo.cycle = int64(n) - 2
+		}
+		for lfo.cycle < int64(n) { // new random levels for each cycle passed
+			lfo.rndA, lfo.rndB = lfo.rndB, 2*lfo.rnd.Float64()-1
+			lfo.cycle++
+		}
+		if lfo.Shape == LFOSampleHold {
+			lfo.value = lfo.rndA
+		} else {
+			lfo.value = lfo.rndA + (lfo.rndB-lfo.rndA)*(1-math.Cos(π*f))/2
+		}
+	}
+	return lfo.value
+}
+
+// EnvSource uses an envelope as a modulation source, e.g. for a filter sweep
+type EnvSource struct {
+	Enveloper
+}
+
+// Value is
+func (es EnvSource) Value(t Seconds) float64 {
+	return float64(es.Amplitude(t))
+}
+
+// ConstSource is a fixed value, e.g. a note's velocity
+type ConstSource float64
+
+// Value is
+func (cs ConstSource) Value(t Seconds) float64 {
+	return float64(cs)
+}
+
+// KeySource is the key of a note as a modulation source: octaves from middle C (so key tracking a pitch
+// target with depth 1 follows the keyboard exactly)
+func KeySource(key int) ConstSource {
+	return ConstSource(float64(key-60) / 12)
+}
+
+// CCBank holds the latest value of each MIDI controller, set from any goroutine
+type CCBank struct {
+	cc [128]uint64 // Bits of a float64, 0...1
+}
+
+// MIDICC is the bank that MIDI input and the UI set
+var MIDICC = &CCBank{}
+
+// Set sets controller cc from its 7 bit MIDI value
+func (cb *CCBank) Set(cc int, v int) {
+	if cc >= 0 && cc < len(cb.cc) {
+		atomic.StoreUint64(&cb.cc[cc], math.Float64bits(float64(v)/127))
+	}
+}
+
+// Get is controller cc, 0...1
+func (cb *CCBank) Get(cc int) float64 {
+	if cc < 0 || cc >= len(cb.cc) {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(&cb.cc[cc]))
+}
+
+// CCSource is a MIDI controller as a modulation source
+type CCSource struct {
+	Bank *CCBank
+	CC   int
+}
+
+// Value is
+func (cs CCSource) Value(t Seconds) float64 {
+	return cs.Bank.Get(cs.CC)
+}
+
+// ModTarget is a parameter that can be modulated
+type ModTarget struct {
+	Name     string
+	Base     float64 // Value with no modulation
+	Exp      bool    // Modulation multiplies Base by 2 to the power of the sum, rather than adding to it
+	Min, Max float64 // Limits, if Min < Max
+	set      func(v float64)
+	sum      float64 // Of the modulation this sample
+	last     float64
+	setOnce  bool
+}
+
+// Clamp limits the target's value
+func (mt *ModTarget) Clamp(min, max float64) *ModTarget {
+	mt.Min, mt.Max = min, max
+	return mt
+}
+
+// ModRoute sends a source to a target
+type ModRoute struct {
+	Source ModSource
+	Target string
+	Depth  float64
+}
+
+// ModMatrix routes modulation sources to targets
+type ModMatrix struct {
+	targets map[string]*ModTarget
+	order   []*ModTarget
+	Routes  []ModRoute
+	lastT   Seconds
+	ran     bool
+}
+
+// NewModMatrix makes an empty one
+func NewModMatrix() *ModMatrix {
+	return &ModMatrix{targets: map[string]*ModTarget{}}
+}
+
+// AddTarget makes a parameter available for modulation, set by set and normally at base
+func (mm *ModMatrix) AddTarget(name string, base float64, set func(v float64)) *ModTarget {
+	mt := &ModTarget{Name: name, Base: base, set: set}
+	if old, ok := mm.targets[name]; ok {
+		*old = *mt
+		return old
+	}
+	mm.targets[name] = mt
+	mm.order = append(mm.order, mt)
+	return mt
+}
+
+// AddExpTarget makes a pitch-like parameter available, where depths are in octaves
+func (mm *ModMatrix) AddExpTarget(name string, base float64, set func(v float64)) *ModTarget {
+	mt := mm.AddTarget(name, base, set)
+	mt.Exp = true
+	return mt
+}
+
+// AddField makes a float64 field available, e.g. mm.AddField("mix", &chorus.Mix)
+func (mm *ModMatrix) AddField(name string, p *float64) *ModTarget {
+	return mm.AddTarget(name, *p, func(v float64) { *p = v })
+}
+
+// Target finds a target by name
+func (mm *ModMatrix) Target(name string) *ModTarget {
+	return mm.targets[name]
+}
+
+// Route sends a source to a named target with a depth (may be negative)
+func (mm *ModMatrix) Route(src ModSource, target string, depth float64) error {
+	if _, ok := mm.targets[target]; !ok {
+		return fmt.Errorf("modulation: no target %q", target)
+	}
+	mm.Routes = append(mm.Routes, ModRoute{Source: src, Target: target, Depth: depth})
+	return nil
+}
+
+// Retrigger restarts any key synced LFOs at global time t
+func (mm *ModMatrix) Retrigger(t Seconds) {
+	for _, r := range mm.Routes {
+		if lfo, ok := r.Source.(*LFO); ok {
+			lfo.Retrigger(t)
+		}
+	}
+}
+
+// Update sets every target for global time t (once only, however many times it is asked)
+func (mm *ModMatrix) Update(t Seconds) {
+	if mm.ran && t == mm.lastT {
+		return
+	}
+	mm.ran, mm.lastT = true, t
+	for _, mt := range mm.order {
+		mt.sum = 0
+	}
+	for _, r := range mm.Routes {
+		if mt, ok := mm.targets[r.Target]; ok {
+			mt.sum += r.Depth * r.Source.Value(t)
+		}
+	}
+	for _, mt := range mm.order {
+		v := mt.Base + mt.sum
+		if mt.Exp {
+			v = mt.Base * math.Pow(2, mt.sum)
+		}
+		if mt.Min < mt.Max {
+			v = math.Max(mt.Min, math.Min(mt.Max, v))
+		}
+		if !mt.setOnce || v != mt.last {
+			mt.set(v)
+			mt.last, mt.setOnce = v, true
+		}
+	}
+}
+
+// ModOsc runs a modulation matrix along with an oscillator, and has a Level for tremolo
+type ModOsc struct {
+	Osciller
+	Matrix *ModMatrix
+	Level  float64
+}
+
+// NewModOsc wraps an oscillator, adding its level as the target "level"
+func NewModOsc(osc Osciller, mm *ModMatrix) *ModOsc {
+	mo := &ModOsc{Osciller: osc, Matrix: mm, Level: 1}
+	mm.AddField("level", &mo.Level)
+	return mo
+}
+
+// Amplitude updates the modulation, then plays the oscillator
+func (mo *ModOsc) Amplitude(t Seconds) Volts {
+	mo.Matrix.Update(t)
+	return Volts(mo.Level) * mo.Osciller.Amplitude(t)
+}
+
+// AmplitudeLR is the same, in stereo if the oscillator is
+func (mo *ModOsc) AmplitudeLR(t Seconds) (l, r Volts) {
+	so, ok := mo.Osciller.(StereoOsciller)
+	if !ok {
+		a := mo.Amplitude(t)
+		return a, a
+	}
+	mo.Matrix.Update(t)
+	l, r = so.AmplitudeLR(t)
+	return Volts(mo.Level) * l, Volts(mo.Level) * r
+}
+
+// Release passes on to the oscillator
+func (mo *ModOsc) Release(t Seconds) {
+	if r, ok := mo.Osciller.(Releaser); ok {
+		r.Release(t)
+	}
+}
+
+// Pulse is a pulse wave whose width can be modulated (PWM)
+type Pulse struct {
+	*Oscillator
+	Width float64 // Fraction of the cycle spent high, 0...1 (0.5 is a square)
+}
+
+// NewPulse makes one starting at global time t
+func NewPulse(t Seconds, ν Hertz, width float64) *Pulse {
+	p := &Pulse{Width: width}
+	p.Oscillator = NewWave(t, ν, func(a Angle) Volts {
+		if cycle(a) < τ*p.Width {
+			return 1
+		}
+		return -1
+	})
+	return p
+}
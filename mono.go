@@ -0,0 +1,208 @@
+package main
+
+import "sync"
+
+// ███╗   ███╗ ██████╗ ███╗   ██╗ ██████╗
+// ████╗ ████║██╔═══██╗████╗  ██║██╔═══██╗
+// ██╔████╔██║██║   ██║██╔██╗ ██║██║   ██║
+// ██║╚██╔╝██║██║   ██║██║╚██╗██║██║   ██║
+// ██║ ╚═╝ ██║╚██████╔╝██║ ╚████║╚██████╔╝
+// ╚═╝     ╚═╝ ╚═════╝ ╚═╝  ╚═══╝ ╚═════╝
+
+// Mono mode plays one Sound at a time, for leads and bass lines. Keys held down are kept on a stack, and
+// a priority rule picks which of them sounds; letting go of a key goes back to whichever is then chosen.
+// Changing note retunes the one Sound's oscillator (so the phase carries on) and, unless playing legato,
+// restarts its envelope, at the new note's velocity.
+
+// Priority picks which held key a mono player sounds
+type Priority int
+
+// Note priorities
+const (
+	LastNote    Priority = iota // The most recently pressed
+	LowestNote                  // Good for bass lines
+	HighestNote                 // Good for leads
+)
+
+// heldKey is a key down, and how hard it was struck
+type heldKey struct {
+	key      int
+	velocity float64
+}
+
+// MonoPlayer is a Player with just one voice
+type MonoPlayer struct {
+	Syn       *Synth
+	Make      NoteMaker
+	Track     string     // Mixer track the voice plays through
+	Priority  Priority   //
+	Legato    bool       // Changing note while one is held keeps the envelope going; otherwise it restarts
+	Glide     Seconds    // Portamento time (0 for none)...
+	GlideRate float64    // ...or rate, in semitones per second
+	Curve     GlideCurve //
+	BendRange float64    // Semitones
+	mu        sync.Mutex
+	stack     []heldKey // Keys down, oldest first
+	snd       *Sound    // The voice, once something has been played
+	glide     *Glider
+	level     *ModOsc // Sets the voice's level for each note's velocity...
+	made      float64 // ...relative to the velocity it was made with
+	key       int     // The key sounding, or -1 once released
+	bend      float64
+}
+
+// NewMonoPlayer makes one playing on the main track
+func NewMonoPlayer(syn *Synth, mk NoteMaker, pr Priority) *MonoPlayer {
+	return &MonoPlayer{Syn: syn, Make: mk, Track: MainTrack, Priority: pr, BendRange: 2, key: -1}
+}
+
+// SetMaker changes how its voice is made, from the next one on
+func (mp *MonoPlayer) SetMaker(mk NoteMaker) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.Make = mk
+}
+
+// SetGlide sets the portamento time (0 for none)
+func (mp *MonoPlayer) SetGlide(glide Seconds) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.Glide = glide
+}
+
+// SetLegato turns legato on or off
+func (mp *MonoPlayer) SetLegato(legato bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.Legato = legato
+}
+
+// SetPriority changes which held key sounds, from the next key pressed or let go
+func (mp *MonoPlayer) SetPriority(pr Priority) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.Priority = pr
+}
+
+// NoteOn is
+func (mp *MonoPlayer) NoteOn(t Seconds, key int, velocity float64) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.remove(key)
+	mp.stack = append(mp.stack, heldKey{key: key, velocity: velocity})
+	mp.play(t)
+}
+
+// NoteOff is
+func (mp *MonoPlayer) NoteOff(t Seconds, key int) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if !mp.remove(key) {
+		return
+	}
+	if len(mp.stack) == 0 {
+		mp.Syn.Change(func() { mp.snd.Release(t) })
+		mp.key = -1
+		return
+	}
+	mp.play(t)
+}
+
+// PitchBend is
+func (mp *MonoPlayer) PitchBend(t Seconds, amount float64) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.bend = amount
+	if mp.glide != nil {
+		mp.Syn.Change(func() {
+			mp.glide.BendRange = mp.BendRange
+			mp.glide.Bend(amount)
+		})
+	}
+}
+
+// Held is the keys down, oldest first
+func (mp *MonoPlayer) Held() []int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	keys := make([]int, len(mp.stack))
+	for i, hk := range mp.stack {
+		keys[i] = hk.key
+	}
+	return keys
+}
+
+// remove takes a key off the stack, saying if it was there
+func (mp *MonoPlayer) remove(key int) bool {
+	for i, hk := range mp.stack {
+		if hk.key == key {
+			mp.stack = append(mp.stack[:i], mp.stack[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// chosen is the held key that should sound
+func (mp *MonoPlayer) chosen() heldKey {
+	hk := mp.stack[len(mp.stack)-1]
+	for _, h := range mp.stack {
+		if (mp.Priority == LowestNote && h.key < hk.key) || (mp.Priority == HighestNote && h.key > hk.key) {
+			hk = h
+		}
+	}
+	return hk
+}
+
+// play makes the voice sound the chosen key at t
+func (mp *MonoPlayer) play(t Seconds) {
+	hk := mp.chosen()
+	if hk.key == mp.key {
+		return
+	}
+	ν := KeyFreq(hk.key)
+	retrigger := !mp.Legato || mp.key < 0 // after a release there is nothing to be legato with...
+	if mp.snd != nil && !retrigger {
+		mp.Syn.Change(func() { retrigger = mp.snd.End <= t }) // ...nor once the voice has died away
+	}
+	mp.key = hk.key
+	if mp.snd == nil || mp.glide.Tuner == nil || (retrigger && !mp.restarts()) {
+		mp.voice(t, ν, hk.velocity)
+	} else if retrigger { // the same voice with its envelope started again; the mixer may be reading it
+		mp.Syn.Change(func() {
+			mp.snd.Env.(Restarter).Restart(t)
+			mp.snd.Note.Start, mp.snd.Start, mp.snd.End = t, t, t+mp.snd.Env.Length()
+			mp.level.Matrix.Target("level").Base = hk.velocity / mp.made
+		})
+		mp.Syn.KeepSound(mp.snd) // it may have died away, and been pruned, while no key was down
+	}
+	mp.Syn.Change(func() {
+		mp.glide.Time, mp.glide.Rate, mp.glide.Curve = mp.Glide, mp.GlideRate, mp.Curve
+		mp.glide.GlideTo(t, ν)
+	})
+}
+
+// restarts is whether the voice can be started again at any velocity, rather than made anew
+func (mp *MonoPlayer) restarts() bool {
+	_, ok := mp.snd.Env.(Restarter)
+	return ok && mp.made > 0
+}
+
+// voice makes a new voice, the first or one to replace one that can't be retuned or restarted
+func (mp *MonoPlayer) voice(t Seconds, ν Hertz, velocity float64) {
+	n, tn := mp.Make(t, ν, velocity)
+	if old := mp.snd; old != nil {
+		mp.Syn.Change(func() { old.Release(t) })
+	}
+	from := ν
+	if mp.glide != nil && (mp.Glide > 0 || mp.GlideRate > 0) {
+		from = mp.glide.FreqAt(t)
+	}
+	mp.level = NewModOsc(n.Osc, NewModMatrix())
+	mp.glide = NewGlider(mp.level, tn, from)
+	mp.glide.BendRange = mp.BendRange
+	mp.glide.Bend(mp.bend)
+	n.Osc = mp.glide
+	mp.made = velocity
+	mp.snd = mp.Syn.AddSoundTo(n, t, mp.Track)
+}
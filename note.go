@@ -60,13 +60,63 @@ func GetFreq(note string) Hertz {
 	return NoteFreqs[note]
 }
 
+// KeyFreq returns the equal tempered frequency of a MIDI key number (60 is middle C, 69 is A4 at 440Hz)
+func KeyFreq(key int) Hertz {
+	return 440 * Hertz(math.Pow(2, float64(key-69)/12))
+}
+
+// FreqKey is the nearest key to a frequency
+func FreqKey(ν Hertz) int {
+	return 69 + int(math.Round(12*math.Log2(float64(ν/440))))
+}
+
+// Scale is the semitones above its root of the notes in each octave
+type Scale []int
+
+// Scales by name
+var Scales = map[string]Scale{
+	"chromatic":  {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	"major":      {0, 2, 4, 5, 7, 9, 11},
+	"minor":      {0, 2, 3, 5, 7, 8, 10},
+	"pentatonic": {0, 2, 4, 7, 9},
+	"blues":      {0, 3, 5, 6, 7, 10},
+}
+
+// Has is whether a key is in the scale, rooted at the key root (any octave)
+func (sc Scale) Has(key int, root int) bool {
+	d := ((key-root)%12 + 12) % 12
+	for _, s := range sc {
+		if s == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Snap is the key in the scale nearest to a (fractional) key
+func (sc Scale) Snap(key float64, root int) int {
+	best, dist := int(math.Round(key)), math.Inf(1)
+	for k := int(math.Floor(key)) - 6; k <= int(math.Ceil(key))+6; k++ {
+		if d := math.Abs(float64(k) - key); d < dist && sc.Has(k, root) {
+			best, dist = k, d
+		}
+	}
+	return best
+}
+
+// KeyName names a key, e.g. "C#4" for 61
+func KeyName(key int) string {
+	names := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+	return fmt.Sprintf("%s%d", names[(key%12+12)%12], key/12-1)
+}
+
 // Note is an instance of a voice, played with an envelope
 type Note struct {
 	Start    Seconds
 	BaseFreq Hertz
 	Env      Enveloper
 	Osc      Osciller // just for now
-	//	Voice *Voicer // TODO
+	Voice    Voicer   // The voice this note is an instance of, if any
 }
 
 // NewNote makes one
@@ -84,3 +134,30 @@ func (n *Note) Length() Seconds {
 func (n *Note) Amplitude(t Seconds) Volts {
 	return n.Env.Amplitude(t) * n.Osc.Amplitude(t)
 }
+
+// Release tells the envelope and oscillator (if they care) that the note has been let go at global time t
+func (n *Note) Release(t Seconds) {
+	if r, ok := n.Env.(Releaser); ok {
+		r.Release(t)
+	}
+	if r, ok := n.Osc.(Releaser); ok {
+		r.Release(t)
+	}
+}
+
+// StereoOsciller is an Osciller that can also give separate left and right signals
+type StereoOsciller interface {
+	Osciller
+	AmplitudeLR(t Seconds) (l, r Volts)
+}
+
+// AmplitudeLR returns the signal in stereo, the same on both sides unless the oscillator is stereo
+func (n *Note) AmplitudeLR(t Seconds) (l, r Volts) {
+	e := n.Env.Amplitude(t)
+	if so, ok := n.Osc.(StereoOsciller); ok {
+		l, r = so.AmplitudeLR(t)
+		return e * l, e * r
+	}
+	a := e * n.Osc.Amplitude(t)
+	return a, a
+}
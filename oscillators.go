@@ -38,21 +38,55 @@ func (osc *Oscillator) Amplitude(t Seconds) Volts {
 	return osc.Wave(osc.Phase)
 }
 
+// Some simple waveforms (those with corners are not band limited, so alias at high pitches)
+var (
+	SineWave     Waveform = func(a Angle) Volts { return Volts(math.Sin(float64(a))) }
+	SawWave      Waveform = func(a Angle) Volts { return Volts(cycle(a)/π - 1) }
+	SquareWave   Waveform = func(a Angle) Volts { return Volts(1 - 2*math.Floor(cycle(a)/π)) }
+	TriangleWave Waveform = func(a Angle) Volts { return Volts(math.Abs(cycle(a)/π*2-2) - 1) }
+)
+
+// cycle is where an angle falls in its cycle, 0...τ
+func cycle(a Angle) float64 {
+	c := math.Mod(float64(a), τ)
+	if c < 0 {
+		c += τ
+	}
+	return c
+}
+
 // NewSine returns a new sine wave oscillator starting at global time t
 func NewSine(t Seconds, newν Hertz) *Oscillator {
 	//	fmt.Printf("New sine osc at %f\n", t)
+	return NewWave(t, newν, SineWave)
+}
+
+// NewWave returns an oscillator of any waveform starting at global time t
+func NewWave(t Seconds, newν Hertz, wave Waveform) *Oscillator {
 	return &Oscillator{
 		T0:      t, // Global start time
 		ν:       newν,
 		Phase:   0,
 		PhaseAt: 0,
-		Wave: func(a Angle) Volts {
-			return Volts(math.Sin(float64(a)))
-		},
+		Wave:    wave,
 	}
 }
 
-// NewFreq updates the frequency and Phase
+// NewFreq updates the frequency; the phase carries on from where it got to, so the wave doesn't jump
 func (osc *Oscillator) NewFreq(ν Hertz) {
 	osc.ν = ν
 }
+
+// NewFreqAt changes the frequency at global time t, first bringing the phase up to t at the old one, so
+// the change happens exactly then rather than from the last sample played
+func (osc *Oscillator) NewFreqAt(t Seconds, ν Hertz) {
+	ot := t - osc.T0
+	osc.Phase += Angle(ot-osc.PhaseAt) * τ * Angle(osc.ν)
+	osc.PhaseAt = ot
+	osc.ν = ν
+}
+
+// Freq is the current frequency
+func (osc *Oscillator) Freq() Hertz {
+	return osc.ν
+}
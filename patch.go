@@ -0,0 +1,841 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ██████╗  █████╗ ████████╗ ██████╗██╗  ██╗
+// ██╔══██╗██╔══██╗╚══██╔══╝██╔════╝██║  ██║
+// ██████╔╝███████║   ██║   ██║     ███████║
+// ██╔═══╝ ██╔══██║   ██║   ██║     ██╔══██║
+// ██║     ██║  ██║   ██║   ╚██████╗██║  ██║
+// ╚═╝     ╚═╝  ╚═╝   ╚═╝    ╚═════╝╚═╝  ╚═╝
+
+// Patches are plain text definitions of Voices, one statement per line:
+//
+//   # comments start with # or //
+//   include "common.patch"        # reads another file in place, relative to this one
+//   voice Pluck                   # voices run to "end"; lines outside any voice make one named after the file
+//     Freq MiddleC                # unnamed stages are wired one after another, in order
+//     Sine
+//     lp = LowPass 2kHz q=0.9     # named stages are only wired explicitly
+//     env = ADSR a=5ms d=300ms s=-12dB r=0.5s
+//     out = Channel left
+//     sine -> lp -> env.in        # wires, as stage or stage.port
+//     env -> out
+//   end
+//
+// Parameters can be given in order or by name, with units: Hz, kHz, s, ms, dB, % or note names (C4, F#3,
+// Bb2, MiddleC, or "note" for the pitch of the note being played).
+
+// PatchDir is where patches are looked for by name
+var PatchDir = "patches"
+
+// patchPos is a place in a patch file
+type patchPos struct {
+	File      string
+	Line, Col int
+}
+
+func (p patchPos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// errorf makes an error message pointing here
+func (p patchPos) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", p, fmt.Sprintf(format, args...))
+}
+
+// patchTokenKind is what sort of token it is
+type patchTokenKind int
+
+// Token kinds
+const (
+	tokEOF patchTokenKind = iota
+	tokNewline
+	tokIdent
+	tokNumber
+	tokString
+	tokArrow
+	tokEquals
+	tokDot
+)
+
+func (k patchTokenKind) String() string {
+	return [...]string{"end of file", "end of line", "name", "number", "string", "->", "=", "."}[k]
+}
+
+// patchToken is one lexical item
+type patchToken struct {
+	Kind patchTokenKind
+	Text string  // Identifier or string contents
+	Num  float64 // Value of a number
+	Unit string  // Unit stuck on the end of a number, e.g. "ms"
+	Pos  patchPos
+}
+
+func (t patchToken) String() string {
+	switch t.Kind {
+	case tokIdent:
+		return strconv.Quote(t.Text)
+	case tokNumber:
+		return fmt.Sprintf("%g%s", t.Num, t.Unit)
+	case tokString:
+		return strconv.Quote(t.Text)
+	}
+	return t.Kind.String()
+}
+
+// patchLexer splits a file into tokens
+type patchLexer struct {
+	src       []rune
+	i         int
+	line, col int
+	file      string
+}
+
+func newPatchLexer(file string, src []byte) *patchLexer {
+	return &patchLexer{src: []rune(string(src)), line: 1, col: 1, file: file}
+}
+
+// peekRune looks ahead k runes, giving 0 past the end
+func (lx *patchLexer) peekRune(k int) rune {
+	if lx.i+k < len(lx.src) {
+		return lx.src[lx.i+k]
+	}
+	return 0
+}
+
+// advance moves on a rune, keeping track of the line and column
+func (lx *patchLexer) advance() rune {
+	r := lx.src[lx.i]
+	lx.i++
+	if r == '\n' {
+		lx.line++
+		lx.col = 1
+	} else {
+		lx.col++
+	}
+	return r
+}
+
+// isIdentRune is true for runes that can carry on a name (# allows sharps in note names)
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '#'
+}
+
+// next returns the next token
+func (lx *patchLexer) next() (patchToken, error) {
+	for {
+		r := lx.peekRune(0)
+		switch {
+		case r == ' ' || r == '\t' || r == '\r':
+			lx.advance()
+			continue
+		case r == '#' || (r == '/' && lx.peekRune(1) == '/'):
+			for lx.i < len(lx.src) && lx.peekRune(0) != '\n' {
+				lx.advance()
+			}
+			continue
+		}
+		break
+	}
+	tok := patchToken{Pos: patchPos{File: lx.file, Line: lx.line, Col: lx.col}}
+	if lx.i >= len(lx.src) {
+		tok.Kind = tokEOF
+		return tok, nil
+	}
+	r := lx.peekRune(0)
+	switch {
+	case r == '\n':
+		lx.advance()
+		tok.Kind = tokNewline
+	case r == '-' && lx.peekRune(1) == '>':
+		lx.advance()
+		lx.advance()
+		tok.Kind = tokArrow
+	case r == '=':
+		lx.advance()
+		tok.Kind = tokEquals
+	case r == '.' && !unicode.IsDigit(lx.peekRune(1)):
+		lx.advance()
+		tok.Kind = tokDot
+	case r == '"':
+		lx.advance()
+		var sb strings.Builder
+		for {
+			if lx.i >= len(lx.src) || lx.peekRune(0) == '\n' {
+				return tok, tok.Pos.errorf("string not closed")
+			}
+			c := lx.advance()
+			if c == '"' {
+				break
+			}
+			sb.WriteRune(c)
+		}
+		tok.Kind, tok.Text = tokString, sb.String()
+	case unicode.IsDigit(r) || r == '.' || ((r == '-' || r == '+') && (unicode.IsDigit(lx.peekRune(1)) || lx.peekRune(1) == '.')):
+		start := lx.i
+		lx.advance()
+		for unicode.IsDigit(lx.peekRune(0)) || lx.peekRune(0) == '.' {
+			lx.advance()
+		}
+		n, err := strconv.ParseFloat(string(lx.src[start:lx.i]), 64)
+		if err != nil {
+			return tok, tok.Pos.errorf("bad number %q", string(lx.src[start:lx.i]))
+		}
+		ustart := lx.i
+		for unicode.IsLetter(lx.peekRune(0)) || lx.peekRune(0) == '%' {
+			lx.advance()
+		}
+		tok.Kind, tok.Num, tok.Unit = tokNumber, n, string(lx.src[ustart:lx.i])
+	case unicode.IsLetter(r) || r == '_':
+		start := lx.i
+		for isIdentRune(lx.peekRune(0)) {
+			lx.advance()
+		}
+		tok.Kind, tok.Text = tokIdent, string(lx.src[start:lx.i])
+	default:
+		return tok, tok.Pos.errorf("unexpected %q", r)
+	}
+	return tok, nil
+}
+
+// PatchArgs are the parameters given to a stage in a patch, by name
+type PatchArgs struct {
+	Type string
+	Pos  patchPos
+	SR   Hertz
+	vals map[string]patchToken
+}
+
+// has says whether a parameter was given
+func (a *PatchArgs) has(name string) bool {
+	_, ok := a.vals[name]
+	return ok
+}
+
+// Freq reads a frequency; fromNote is true if it is the note's own (given as "note", or not given at all)
+func (a *PatchArgs) Freq(name string) (ν Hertz, fromNote bool, err error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return 0, true, nil
+	}
+	switch t.Kind {
+	case tokNumber:
+		switch strings.ToLower(t.Unit) {
+		case "", "hz":
+			return Hertz(t.Num), false, nil
+		case "khz":
+			return Hertz(t.Num * 1000), false, nil
+		}
+	case tokIdent:
+		if t.Text == "note" {
+			return 0, true, nil
+		}
+		if strings.EqualFold(t.Text, "MiddleC") {
+			return MiddleCfreq, false, nil
+		}
+		if k, ok := sfzNoteKey(t.Text); ok {
+			return KeyFreq(k), false, nil
+		}
+	}
+	return 0, false, t.Pos.errorf("%s %s: %s is not a frequency", a.Type, name, t)
+}
+
+// Time reads a time, or gives def
+func (a *PatchArgs) Time(name string, def Seconds) (Seconds, error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return def, nil
+	}
+	if t.Kind == tokNumber {
+		switch t.Unit {
+		case "", "s":
+			return Seconds(t.Num), nil
+		case "ms":
+			return Seconds(t.Num / 1000), nil
+		}
+	}
+	return 0, t.Pos.errorf("%s %s: %s is not a time", a.Type, name, t)
+}
+
+// Level reads a gain (dB, % or plain), giving it as a plain ratio, or def
+func (a *PatchArgs) Level(name string, def float64) (float64, error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return def, nil
+	}
+	if t.Kind == tokNumber {
+		switch t.Unit {
+		case "":
+			return t.Num, nil
+		case "dB", "db":
+			return math.Pow(10, t.Num/20), nil
+		case "%":
+			return t.Num / 100, nil
+		}
+	}
+	return 0, t.Pos.errorf("%s %s: %s is not a level", a.Type, name, t)
+}
+
+// Num reads a plain number, or gives def
+func (a *PatchArgs) Num(name string, def float64) (float64, error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return def, nil
+	}
+	if t.Kind == tokNumber && t.Unit == "" {
+		return t.Num, nil
+	}
+	return 0, t.Pos.errorf("%s %s: %s is not a plain number", a.Type, name, t)
+}
+
+// Word reads one of a set of words, or gives def
+func (a *PatchArgs) Word(name string, def string, words ...string) (string, error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return def, nil
+	}
+	if t.Kind == tokIdent {
+		for _, w := range words {
+			if strings.EqualFold(t.Text, w) {
+				return w, nil
+			}
+		}
+	}
+	return "", t.Pos.errorf("%s %s: %s should be one of %s", a.Type, name, t, strings.Join(words, ", "))
+}
+
+// Str reads a quoted string, or gives def
+func (a *PatchArgs) Str(name string, def string) (string, error) {
+	t, ok := a.vals[name]
+	if !ok {
+		return def, nil
+	}
+	if t.Kind == tokString {
+		return t.Text, nil
+	}
+	return "", t.Pos.errorf("%s %s: %s is not a quoted string", a.Type, name, t)
+}
+
+// Wave compiles a wave expression, giving errors at their place in the patch
+func (a *PatchArgs) Wave(name string) (*WaveExpr, error) {
+	src, err := a.Str(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if !a.has(name) {
+		return nil, a.Pos.errorf("%s needs an %s", a.Type, name)
+	}
+	we, err := CompileWave(src)
+	if werr, ok := err.(*WaveError); ok {
+		pos := a.vals[name].Pos
+		pos.Col += werr.Pos // just past the opening quote
+		return nil, pos.errorf("%s", werr.Msg)
+	}
+	return we, err
+}
+
+// PatchStage is a type of stage that patches can use
+type PatchStage struct {
+	Params []string                               // Names, in the order they may be given without naming them
+	Make   func(a *PatchArgs) (StageMaker, error) // Check the parameters and make the stage maker
+}
+
+// PatchStages are the stage types patches know, by name
+var PatchStages = map[string]*PatchStage{
+	"Sine": {Params: []string{"freq"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		ν, fromNote, err := a.Freq("freq")
+		return func(nc NoteContext) Stage {
+			if fromNote {
+				ν = nc.Freq
+			}
+			return NewOscStage(NewSine(nc.Start, ν))
+		}, err
+	}},
+	"Freq": {Params: []string{"freq"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		ν, fromNote, err := a.Freq("freq")
+		return func(nc NoteContext) Stage {
+			if fromNote {
+				return NewFreqStage(nc.Freq)
+			}
+			return NewFreqStage(ν)
+		}, err
+	}},
+	"Wave": {Params: []string{"expr", "freq", "ratio"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		we, err := a.Wave("expr")
+		if err != nil {
+			return nil, err
+		}
+		if len(we.Params()) == 0 {
+			we.Tabulate(WaveTableSize)
+		}
+		ratio, err := a.Num("ratio", 1)
+		if err == nil && ratio <= 0 {
+			err = a.vals["ratio"].Pos.errorf("Wave ratio: %g should be above 0", ratio)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ν, fromNote, err := a.Freq("freq")
+		return func(nc NoteContext) Stage {
+			if fromNote {
+				ν = nc.Freq
+			}
+			return NewWaveStage(nc.Start, ν, ratio, we.Clone()) // each note has its own parameters
+		}, err
+	}},
+	"LowPass":  biquadStage(LowPass),
+	"HighPass": biquadStage(HighPass),
+	"BandPass": biquadStage(BandPass),
+	"Notch":    biquadStage(Notch),
+	"Ladder": {Params: []string{"freq", "res"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		if !a.has("freq") {
+			return nil, a.Pos.errorf("Ladder needs a freq")
+		}
+		ν, fromNote, err := a.Freq("freq")
+		if err != nil {
+			return nil, err
+		}
+		res, err := a.Num("res", 0)
+		return func(nc NoteContext) Stage {
+			if fromNote {
+				ν = nc.Freq
+			}
+			return NewFilterStage(NewLadder(a.SR, ν, res))
+		}, err
+	}},
+	"ADSR": {Params: []string{"a", "d", "s", "r"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		ta, err1 := a.Time("a", 0.005)
+		td, err2 := a.Time("d", 0.1)
+		ls, err3 := a.Level("s", 1)
+		tr, err4 := a.Time("r", 0.1)
+		for _, err := range []error{err1, err2, err3, err4} {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return func(nc NoteContext) Stage {
+			return NewEnvStage(NewADSR(nc.Start, false, ta, td, Volts(ls), tr, 0, 0, 0))
+		}, nil
+	}},
+	"Channel": {Params: []string{"side"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		w, err := a.Word("side", "centre", "left", "right", "centre", "center", "both")
+		side := map[string]Side{"left": Left, "right": Right}[w] // anything else is Centre
+		return func(nc NoteContext) Stage {
+			return NewChannelStage(side)
+		}, err
+	}},
+}
+
+// biquadStage is a filter stage type of the given kind
+func biquadStage(kind FilterType) *PatchStage {
+	return &PatchStage{Params: []string{"freq", "q"}, Make: func(a *PatchArgs) (StageMaker, error) {
+		if !a.has("freq") {
+			return nil, a.Pos.errorf("%s needs a freq", a.Type)
+		}
+		ν, fromNote, err := a.Freq("freq")
+		if err != nil {
+			return nil, err
+		}
+		q, err := a.Num("q", ButterworthQ)
+		return func(nc NoteContext) Stage {
+			if fromNote {
+				ν = nc.Freq
+			}
+			return NewFilterStage(NewBiquad(kind, a.SR, ν, q))
+		}, err
+	}}
+}
+
+// voiceBuild is a voice being parsed
+type voiceBuild struct {
+	v     *Voice
+	pos   patchPos // Where it was started
+	prev  string   // Last unnamed stage, to wire the next one from
+	count map[string]int
+}
+
+// patchParser turns tokens into voices
+type patchParser struct {
+	lexers   []*patchLexer // Include stack, innermost last
+	tok      patchToken
+	ahead    []patchToken
+	sr       Hertz
+	voices   []*Voice
+	implicit *voiceBuild // Voice made of lines outside any voice block
+	current  *voiceBuild // Voice block being read, if any
+	fileName string
+}
+
+// scan gets a token from the innermost file, going back out to the including file at the end of each
+func (p *patchParser) scan() (patchToken, error) {
+	for {
+		lx := p.lexers[len(p.lexers)-1]
+		tok, err := lx.next()
+		if err != nil || tok.Kind != tokEOF || len(p.lexers) == 1 {
+			return tok, err
+		}
+		p.lexers = p.lexers[:len(p.lexers)-1]
+		return patchToken{Kind: tokNewline, Pos: tok.Pos}, nil
+	}
+}
+
+// next moves on a token
+func (p *patchParser) next() error {
+	if len(p.ahead) > 0 {
+		p.tok, p.ahead = p.ahead[0], p.ahead[1:]
+		return nil
+	}
+	tok, err := p.scan()
+	p.tok = tok
+	return err
+}
+
+// peek looks at the token after the current one
+func (p *patchParser) peek() (patchToken, error) {
+	if len(p.ahead) == 0 {
+		tok, err := p.scan()
+		if err != nil {
+			return tok, err
+		}
+		p.ahead = append(p.ahead, tok)
+	}
+	return p.ahead[0], nil
+}
+
+// expect checks the current token is of a kind, and moves past it
+func (p *patchParser) expect(kind patchTokenKind) (patchToken, error) {
+	tok := p.tok
+	if tok.Kind != kind {
+		return tok, tok.Pos.errorf("expected %s, found %s", kind, tok)
+	}
+	return tok, p.next()
+}
+
+// endOfLine checks the statement has finished
+func (p *patchParser) endOfLine() error {
+	if p.tok.Kind != tokNewline && p.tok.Kind != tokEOF {
+		return p.tok.Pos.errorf("unexpected %s", p.tok)
+	}
+	return nil
+}
+
+// ParsePatch reads the voices defined in src; file names it for messages, includes and the voice
+// made of any lines outside a voice block
+func ParsePatch(file string, src []byte, sr Hertz) ([]*Voice, error) {
+	p := &patchParser{lexers: []*patchLexer{newPatchLexer(file, src)}, sr: sr}
+	p.fileName = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for p.tok.Kind != tokEOF {
+		if p.tok.Kind == tokNewline {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := p.statement(); err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+	if p.current != nil {
+		return nil, p.current.pos.errorf("voice %s has no end", p.current.v.Name)
+	}
+	if p.implicit != nil {
+		p.voices = append([]*Voice{p.implicit.v}, p.voices...)
+	}
+	return p.voices, nil
+}
+
+// statement reads one line
+func (p *patchParser) statement() error {
+	tok := p.tok
+	if tok.Kind != tokIdent {
+		return tok.Pos.errorf("expected a stage, wire, voice or include, found %s", tok)
+	}
+	switch tok.Text {
+	case "include":
+		return p.include()
+	case "voice":
+		if p.current != nil {
+			return tok.Pos.errorf("voice inside voice %s (missing end?)", p.current.v.Name)
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		name, err := p.expect(tokIdent)
+		if err != nil {
+			return err
+		}
+		for _, v := range p.voices {
+			if v.Name == name.Text {
+				return name.Pos.errorf("voice %s defined twice", name.Text)
+			}
+		}
+		p.current = &voiceBuild{v: NewVoice(name.Text), pos: tok.Pos, count: map[string]int{}}
+		return nil
+	case "end":
+		if p.current == nil {
+			return tok.Pos.errorf("end without voice")
+		}
+		p.voices = append(p.voices, p.current.v)
+		p.current = nil
+		return p.next()
+	}
+	vb := p.current
+	if vb == nil {
+		if p.implicit == nil {
+			p.implicit = &voiceBuild{v: NewVoice(p.fileName), pos: tok.Pos, count: map[string]int{}}
+		}
+		vb = p.implicit
+	}
+	after, err := p.peek()
+	if err != nil {
+		return err
+	}
+	switch after.Kind {
+	case tokEquals: // name = Type args
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		return p.stage(vb, tok)
+	case tokArrow, tokDot:
+		return p.wires(vb)
+	}
+	return p.stage(vb, patchToken{}) // unnamed
+}
+
+// include reads another file in place
+func (p *patchParser) include() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	file, err := p.expect(tokString)
+	if err != nil {
+		return err
+	}
+	if err := p.endOfLine(); err != nil {
+		return err
+	}
+	path := file.Text
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file.Pos.File), path)
+	}
+	for _, lx := range p.lexers {
+		if filepath.Clean(lx.file) == filepath.Clean(path) {
+			return file.Pos.errorf("%s includes itself", path)
+		}
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file.Pos.errorf("include: %v", err)
+	}
+	p.lexers = append(p.lexers, newPatchLexer(path, src))
+	if p.tok.Kind == tokEOF { // the include was the last line: its file still has to be read
+		p.tok = patchToken{Kind: tokNewline, Pos: p.tok.Pos}
+	}
+	return nil // the current token (end of line) stands; the next comes from the new file
+}
+
+// stage reads "Type args..." and adds it to the voice, under name if given, or else wired after the last unnamed stage
+func (p *patchParser) stage(vb *voiceBuild, name patchToken) error {
+	typ, err := p.expect(tokIdent)
+	if err != nil {
+		return err
+	}
+	ps, ok := PatchStages[typ.Text]
+	if !ok {
+		return typ.Pos.errorf("unknown stage type %q (known: %s)", typ.Text, strings.Join(patchStageNames(), ", "))
+	}
+	args := &PatchArgs{Type: typ.Text, Pos: typ.Pos, SR: p.sr, vals: map[string]patchToken{}}
+	for n := 0; p.tok.Kind != tokNewline && p.tok.Kind != tokEOF; n++ {
+		param, val := "", p.tok
+		if after, err := p.peek(); err != nil {
+			return err
+		} else if p.tok.Kind == tokIdent && after.Kind == tokEquals {
+			param = p.tok.Text
+			if err := p.next(); err != nil {
+				return err
+			}
+			if err := p.next(); err != nil {
+				return err
+			}
+			val = p.tok
+		} else if n < len(ps.Params) {
+			param = ps.Params[n]
+		} else {
+			return val.Pos.errorf("%s takes at most %d parameters", typ.Text, len(ps.Params))
+		}
+		known := false
+		for _, k := range ps.Params {
+			known = known || k == param
+		}
+		if !known {
+			return val.Pos.errorf("%s has no parameter %q (it has %s)", typ.Text, param, strings.Join(ps.Params, ", "))
+		}
+		if val.Kind != tokNumber && val.Kind != tokIdent && val.Kind != tokString {
+			return val.Pos.errorf("expected a value for %s, found %s", param, val)
+		}
+		if _, dup := args.vals[param]; dup {
+			return val.Pos.errorf("%s %s given twice", typ.Text, param)
+		}
+		args.vals[param] = val
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	mk, err := ps.Make(args)
+	if err != nil {
+		return err
+	}
+	stageName := name.Text
+	if name.Kind != tokIdent {
+		base := strings.ToLower(typ.Text)
+		vb.count[base]++
+		stageName = base
+		if vb.count[base] > 1 {
+			stageName = fmt.Sprintf("%s%d", base, vb.count[base])
+		}
+	}
+	at := typ.Pos
+	if name.Kind == tokIdent {
+		at = name.Pos
+	}
+	if err := vb.v.Add(stageName, mk); err != nil {
+		return at.errorf("%v", err)
+	}
+	if name.Kind != tokIdent {
+		// wire on from the last unnamed stage, unless one end has nothing to wire
+		if vb.prev != "" && len(vb.v.byName[vb.prev].proto.Outputs()) > 0 && len(vb.v.byName[stageName].proto.Inputs()) > 0 {
+			if err := vb.v.Connect(vb.prev, stageName); err != nil {
+				return at.errorf("%v", err)
+			}
+		}
+		vb.prev = stageName
+	}
+	return nil
+}
+
+// wires reads "a -> b.port -> c"
+func (p *patchParser) wires(vb *voiceBuild) error {
+	type ref struct {
+		stage, port string
+		pos         patchPos
+	}
+	read := func() (ref, error) {
+		r := ref{pos: p.tok.Pos}
+		st, err := p.expect(tokIdent)
+		if err != nil {
+			return r, err
+		}
+		r.stage = st.Text
+		if _, ok := vb.v.byName[r.stage]; !ok {
+			return r, st.Pos.errorf("voice %s has no stage %q", vb.v.Name, r.stage)
+		}
+		if p.tok.Kind == tokDot {
+			if err := p.next(); err != nil {
+				return r, err
+			}
+			port, err := p.expect(tokIdent)
+			if err != nil {
+				return r, err
+			}
+			r.port = port.Text
+		}
+		return r, nil
+	}
+	from, err := read()
+	if err != nil {
+		return err
+	}
+	if p.tok.Kind != tokArrow {
+		return p.tok.Pos.errorf("expected ->, found %s", p.tok)
+	}
+	for p.tok.Kind == tokArrow {
+		if err := p.next(); err != nil {
+			return err
+		}
+		to, err := read()
+		if err != nil {
+			return err
+		}
+		src, dst := from.stage, to.stage
+		if from.port != "" {
+			src += "." + from.port
+		}
+		if to.port != "" {
+			dst += "." + to.port
+		}
+		if err := vb.v.Connect(src, dst); err != nil {
+			return to.pos.errorf("%v", err)
+		}
+		from = ref{stage: to.stage, pos: to.pos} // carry on from the stage's main output
+	}
+	return nil
+}
+
+// patchStageNames lists the known stage types
+func patchStageNames() []string {
+	names := []string{}
+	for n := range PatchStages {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePatchFile reads every voice in a patch file
+func ParsePatchFile(path string, sr Hertz) ([]*Voice, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePatch(path, src, sr)
+}
+
+// LoadVoice finds a voice by name in PatchDir: the one in name.patch, or else one of that name in any patch file
+func LoadVoice(name string, sr Hertz) (*Voice, error) {
+	path := filepath.Join(PatchDir, name+".patch")
+	if voices, err := ParsePatchFile(path, sr); err == nil {
+		for _, v := range voices {
+			if v.Name == name {
+				return v, nil
+			}
+		}
+		if len(voices) == 1 {
+			return voices[0], nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	files, _ := filepath.Glob(filepath.Join(PatchDir, "*.patch"))
+	for _, f := range files {
+		voices, err := ParsePatchFile(f, sr)
+		if err != nil {
+			continue // someone else's broken patch shouldn't stop us finding this one
+		}
+		for _, v := range voices {
+			if v.Name == name {
+				return v, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no voice %q in %s", name, PatchDir)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An include on the last line, with no newline after it, is still read
+func TestPatchIncludeAtEnd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inc := "voice Inc\n  Freq MiddleC\n  Sine\n  Channel left\nend\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "inc.patch"), []byte(inc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	voices, err := ParsePatch(filepath.Join(dir, "top.patch"), []byte(`include "inc.patch"`), 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 1 || voices[0].Name != "Inc" {
+		t.Fatalf("got %d voices, want just Inc", len(voices))
+	}
+}
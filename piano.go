@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// ██████╗ ██╗ █████╗ ███╗   ██╗ ██████╗
+// ██╔══██╗██║██╔══██╗████╗  ██║██╔═══██╗
+// ██████╔╝██║███████║██╔██╗ ██║██║   ██║
+// ██╔═══╝ ██║██╔══██║██║╚██╗██║██║   ██║
+// ██║     ██║██║  ██║██║ ╚████║╚██████╔╝
+// ╚═╝     ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝ ╚═════╝
+
+// The piano is a keyboard drawn in the window. Its keys light up while their notes sound, whatever
+// played them (the computer keyboard, a MIDI file, or code adding sounds to the synth), and it can be
+// played with the mouse: the lower on a key it is clicked, the louder, and dragging plays each key
+// passed over. The wheel scrolls it an octave at a time.
+
+// whiteOf is the white key each semitone of an octave is, or is just after (for black keys)
+var whiteOf = [12]int{0, 0, 1, 1, 2, 3, 3, 4, 4, 5, 5, 6}
+
+// isBlack is whether a key is a black one
+func isBlack(key int) bool {
+	switch key % 12 {
+	case 1, 3, 6, 8, 10:
+		return true
+	}
+	return false
+}
+
+// Piano is a keyboard in the window
+type Piano struct {
+	Player  Player
+	Rect    sdl.Rect // Where it is drawn
+	Low     int      // Key at the left, always a C
+	Octaves int      // Shown
+	mouse   int      // Key the mouse is playing, or -1
+	lit     map[int]bool
+}
+
+// NewPiano makes one showing octaves from the C key low, drawn in r
+func NewPiano(pl Player, r sdl.Rect, low int, octaves int) *Piano {
+	pn := &Piano{Player: pl, Rect: r, Low: low - low%12, Octaves: octaves, mouse: -1, lit: map[int]bool{}}
+	pn.Scroll(0)
+	return pn
+}
+
+// whiteW is the width of a white key
+func (pn *Piano) whiteW() int32 {
+	return pn.Rect.W / int32(7*pn.Octaves)
+}
+
+// keyRect is where a key is drawn
+func (pn *Piano) keyRect(key int) sdl.Rect {
+	ww := pn.whiteW()
+	wi := int32(7*((key-pn.Low)/12) + whiteOf[key%12])
+	if !isBlack(key) {
+		return sdl.Rect{X: pn.Rect.X + wi*ww, Y: pn.Rect.Y, W: ww - 1, H: pn.Rect.H}
+	}
+	bw := ww * 3 / 5
+	return sdl.Rect{X: pn.Rect.X + (wi+1)*ww - bw/2, Y: pn.Rect.Y, W: bw, H: pn.Rect.H * 3 / 5}
+}
+
+// KeyAt is the key at a point in the window, and the velocity from how far down the key it is
+func (pn *Piano) KeyAt(x, y int32) (int, float64, bool) {
+	in := func(r sdl.Rect) bool { return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H }
+	if !in(pn.Rect) {
+		return 0, 0, false
+	}
+	for pass := 0; pass < 2; pass++ { // black keys are on top
+		for key := pn.Low; key < pn.Low+12*pn.Octaves; key++ {
+			if isBlack(key) != (pass == 0) {
+				continue
+			}
+			if r := pn.keyRect(key); in(r) {
+				vel := 0.1 + 0.9*float64(y-r.Y)/float64(r.H)
+				return key, vel, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// Light sets the keys sounding, saying whether that changed anything
+func (pn *Piano) Light(keys []int) bool {
+	lit := map[int]bool{}
+	for _, k := range keys {
+		lit[k] = true
+	}
+	if pn.mouse >= 0 {
+		lit[pn.mouse] = true
+	}
+	changed := len(lit) != len(pn.lit)
+	for k := range lit {
+		if !pn.lit[k] {
+			changed = true
+		}
+	}
+	pn.lit = lit
+	return changed
+}
+
+// Draw draws it on a surface
+func (pn *Piano) Draw(s *sdl.Surface) {
+	colour := func(r, g, b uint8) uint32 { return sdl.MapRGB(s.Format, r, g, b) }
+	s.FillRect(&pn.Rect, colour(0, 0, 0))
+	for pass := 0; pass < 2; pass++ {
+		for key := pn.Low; key < pn.Low+12*pn.Octaves; key++ {
+			if isBlack(key) != (pass == 1) {
+				continue
+			}
+			c := colour(240, 240, 240)
+			switch {
+			case pn.lit[key]:
+				c = colour(255, 140, 0)
+			case isBlack(key):
+				c = colour(30, 30, 30)
+			}
+			r := pn.keyRect(key)
+			s.FillRect(&r, c)
+		}
+	}
+}
+
+// MouseDown plays the key clicked at global time t, saying whether it was on the piano
+func (pn *Piano) MouseDown(t Seconds, x, y int32) bool {
+	key, vel, ok := pn.KeyAt(x, y)
+	if !ok {
+		return false
+	}
+	pn.MouseUp(t)
+	pn.mouse = key
+	pn.Player.NoteOn(t, key, vel)
+	return true
+}
+
+// MouseMove follows a drag, moving from key to key, and letting go when it leaves the piano
+func (pn *Piano) MouseMove(t Seconds, x, y int32) {
+	if pn.mouse < 0 {
+		return
+	}
+	key, vel, ok := pn.KeyAt(x, y)
+	if ok && key == pn.mouse {
+		return
+	}
+	pn.MouseUp(t)
+	if ok {
+		pn.mouse = key
+		pn.Player.NoteOn(t, key, vel)
+	}
+}
+
+// MouseUp lets go of the key the mouse is playing, if any
+func (pn *Piano) MouseUp(t Seconds) {
+	if pn.mouse >= 0 {
+		pn.Player.NoteOff(t, pn.mouse)
+		pn.mouse = -1
+	}
+}
+
+// Scroll moves it up (or down) some octaves, keeping it within the MIDI keys
+func (pn *Piano) Scroll(octaves int) {
+	pn.Low += 12 * octaves
+	top := (128 - 12*pn.Octaves) / 12 * 12
+	if pn.Low > top {
+		pn.Low = top
+	}
+	if pn.Low < 0 {
+		pn.Low = 0
+	}
+}
+
+// String is the range shown, for display
+func (pn *Piano) String() string {
+	return fmt.Sprintf("Piano %s-%s", KeyName(pn.Low), KeyName(pn.Low+12*pn.Octaves-1))
+}
@@ -0,0 +1,644 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ██████╗ ██████╗ ███████╗███████╗███████╗████████╗███████╗
+// ██╔══██╗██╔══██╗██╔════╝██╔════╝██╔════╝╚══██╔══╝██╔════╝
+// ██████╔╝██████╔╝█████╗  ███████╗█████╗     ██║   ███████╗
+// ██╔═══╝ ██╔══██╗██╔══╝  ╚════██║██╔══╝     ██║   ╚════██║
+// ██║     ██║  ██║███████╗███████║███████╗   ██║   ███████║
+// ╚═╝     ╚═╝  ╚═╝╚══════╝╚══════╝╚══════╝   ╚═╝   ╚══════╝
+
+// A Preset is the whole description of an instrument (oscillator, envelope, filters, effects and tuning)
+// kept as JSON, so sounds can be made without touching the code. Presets carry a schema version; files
+// from a newer version are refused rather than half understood.
+
+// PresetVersion is the version of the preset schema this code reads and writes
+const PresetVersion = 1
+
+// PresetDir is where presets are looked for at startup
+var PresetDir = "presets"
+
+// Preset is an instrument
+type Preset struct {
+	Version int            `json:"version"`
+	Name    string         `json:"name"`
+	Osc     OscPreset      `json:"osc"`
+	Env     EnvPreset      `json:"env"`
+	Filters []FilterPreset `json:"filters,omitempty"`
+	Effects []EffectPreset `json:"effects,omitempty"`
+	Tuning  TuningPreset   `json:"tuning"`
+}
+
+// OscPreset describes the oscillator
+type OscPreset struct {
+	Wave   string             `json:"wave,omitempty"`   // sine, saw, square or triangle...
+	Expr   string             `json:"expr,omitempty"`   // ...or a wave expression, e.g. "sin(a) + 0.3*sin(3*a)"
+	Params map[string]float64 `json:"params,omitempty"` // Values of the expression's parameters
+	Octave int                `json:"octave,omitempty"` // Octaves up (or down) from the note played
+	Detune float64            `json:"detune,omitempty"` // Cents
+	Unison *UnisonPreset      `json:"unison,omitempty"`
+	wave   Waveform           // Made once by Validate, and shared by every note
+}
+
+// waveExpr compiles the expression, setting its parameters
+func (op *OscPreset) waveExpr() (*WaveExpr, error) {
+	we, err := CompileWave(op.Expr)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range op.Params {
+		if err := we.Set(name, v); err != nil {
+			return nil, err
+		}
+	}
+	return we.Tabulate(WaveTableSize), nil
+}
+
+// setWave makes the oscillator's waveform, tabulating an expression once for all the notes to read
+func (op *OscPreset) setWave() error {
+	if op.Expr == "" {
+		w, ok := presetWaves[op.Wave]
+		if !ok {
+			return fieldError("osc.wave", "%q is not one of %s", op.Wave, names(presetWaves))
+		}
+		op.wave = w
+		return nil
+	}
+	we, err := op.waveExpr()
+	if err != nil {
+		return fieldError("osc.expr", "%s", err)
+	}
+	op.wave = we.Waveform()
+	return nil
+}
+
+// UnisonPreset stacks detuned copies of the oscillator
+type UnisonPreset struct {
+	Voices      int     `json:"voices"`                // 1...16
+	Detune      float64 `json:"detune,omitempty"`      // Cents out to the outermost copies
+	Curve       string  `json:"curve,omitempty"`       // linear (the default) or supersaw
+	Spread      float64 `json:"spread,omitempty"`      // Stereo width, 0...1
+	RandomPhase bool    `json:"randomPhase,omitempty"` //
+}
+
+// EnvPreset describes the envelope; which times matter depends on the type
+type EnvPreset struct {
+	Type       string  `json:"type"` // adsr, triangle, gaussian or hann
+	Delay      Seconds `json:"delay,omitempty"`
+	Attack     Seconds `json:"attack,omitempty"`
+	Hold       Seconds `json:"hold,omitempty"`
+	Decay      Seconds `json:"decay,omitempty"`
+	Sustain    float64 `json:"sustain,omitempty"` // Level, 0...1
+	Release    Seconds `json:"release,omitempty"`
+	MaxSustain Seconds `json:"maxSustain,omitempty"`
+	Length     Seconds `json:"length,omitempty"` // triangle, gaussian and hann
+	Period     Seconds `json:"period,omitempty"` // Repeat time for triangle and gaussian (0 for one shot)
+	Mu         Seconds `json:"mu,omitempty"`     // Centre of a gaussian
+	Sigma      Seconds `json:"sigma,omitempty"`  // Width of a gaussian
+}
+
+// FilterPreset describes one filter, applied to the oscillator in order
+type FilterPreset struct {
+	Type     string  `json:"type"` // lowpass, highpass, bandpass, notch, allpass, lowshelf, highshelf, peaking or ladder
+	Cutoff   Hertz   `json:"cutoff"`
+	Q        float64 `json:"q,omitempty"`        // Biquads; 0 means Butterworth
+	Res      float64 `json:"res,omitempty"`      // Ladder resonance, 0...1
+	Gain     float64 `json:"gain,omitempty"`     // Shelves and peaking, dB
+	Poles    int     `json:"poles,omitempty"`    // Lowpass and highpass: make a Butterworth of this order instead
+	KeyTrack float64 `json:"keyTrack,omitempty"` // 0 fixed cutoff ... 1 cutoff follows the note (relative to middle C)
+}
+
+// EffectPreset describes an effect on the instrument's track, with any parameters not given left at their defaults
+type EffectPreset struct {
+	Type   string             `json:"type"`
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// TuningPreset says how keys become frequencies
+type TuningPreset struct {
+	A4        Hertz   `json:"a4,omitempty"`        // Concert pitch, 440 if not given
+	Transpose int     `json:"transpose,omitempty"` // Semitones
+	Cents     float64 `json:"cents,omitempty"`
+}
+
+// presetWaves are the oscillator waveforms by name
+var presetWaves = map[string]Waveform{"sine": SineWave, "saw": SawWave, "square": SquareWave, "triangle": TriangleWave}
+
+// presetCurves are the unison detune curves by name
+var presetCurves = map[string]DetuneCurve{"linear": DetuneLinear, "supersaw": DetuneSupersaw}
+
+// presetFilters are the biquad filter types by name (ladder is handled separately)
+var presetFilters = map[string]FilterType{
+	"lowpass": LowPass, "highpass": HighPass, "bandpass": BandPass, "notch": Notch,
+	"allpass": AllPass, "lowshelf": LowShelf, "highshelf": HighShelf, "peaking": Peaking,
+}
+
+// presetEffect is an effect type: its parameters with their defaults, and how to make it
+type presetEffect struct {
+	defaults map[string]float64
+	make     func(sr Hertz, p map[string]float64) Effecter
+}
+
+// presetEffects are the effect types by name
+var presetEffects = map[string]presetEffect{
+	"delay": {map[string]float64{"mode": 0, "time": 0.375, "feedback": 0.4, "mix": 0.3, "damp": 4000, "bpm": 0, "division": 0},
+		func(sr Hertz, p map[string]float64) Effecter {
+			d := NewDelay(DelayMode(p["mode"]), sr, 2, Seconds(p["time"]), p["feedback"], p["mix"], Hertz(p["damp"]))
+			if p["bpm"] > 0 && p["division"] > 0 {
+				d.SyncTo(&Tempo{BPM: p["bpm"]}, Division(p["division"]))
+			}
+			return d
+		}},
+	"reverb": {map[string]float64{"room": 0.7, "damping": 0.5, "width": 1, "mix": 0.25, "predelay": 0},
+		func(sr Hertz, p map[string]float64) Effecter {
+			rv := NewReverb(sr, p["room"], p["damping"], p["mix"], 0.5)
+			rv.Width, rv.PreDelay = p["width"], Seconds(math.Min(p["predelay"], 0.5))
+			return rv
+		}},
+	"chorus": {map[string]float64{"voices": 3, "rate": 0.8, "depth": 0.004, "delay": 0.02, "mix": 0.5},
+		func(sr Hertz, p map[string]float64) Effecter {
+			ch := NewChorus(sr, int(p["voices"]))
+			ch.Rate, ch.Depth, ch.Delay, ch.Mix = Hertz(p["rate"]), Seconds(p["depth"]), Seconds(p["delay"]), p["mix"]
+			return ch
+		}},
+	"flanger": {map[string]float64{"rate": 0.25, "depth": 0.002, "delay": 0.003, "feedback": 0.5, "mix": 0.5},
+		func(sr Hertz, p map[string]float64) Effecter {
+			fl := NewFlanger(sr)
+			fl.Rate, fl.Depth, fl.Delay, fl.Feedback, fl.Mix = Hertz(p["rate"]), Seconds(p["depth"]), Seconds(p["delay"]), p["feedback"], p["mix"]
+			return fl
+		}},
+	"phaser": {map[string]float64{"stages": 6, "rate": 0.5, "min": 200, "max": 3000, "feedback": 0.3, "mix": 0.5},
+		func(sr Hertz, p map[string]float64) Effecter {
+			ph := NewPhaser(sr, int(p["stages"]))
+			ph.Rate, ph.MinFreq, ph.MaxFreq, ph.Feedback, ph.Mix = Hertz(p["rate"]), Hertz(p["min"]), Hertz(p["max"]), p["feedback"], p["mix"]
+			return ph
+		}},
+	"vibrato": {map[string]float64{"rate": 5, "cents": 20},
+		func(sr Hertz, p map[string]float64) Effecter {
+			return NewVibrato(sr, Hertz(p["rate"]), p["cents"])
+		}},
+	"compressor": {map[string]float64{"threshold": -18, "ratio": 4, "attack": 0.01, "release": 0.1, "makeup": 0},
+		func(sr Hertz, p map[string]float64) Effecter {
+			c := NewCompressor(sr, p["threshold"], p["ratio"], Seconds(p["attack"]), Seconds(p["release"]))
+			c.Makeup = p["makeup"]
+			return c
+		}},
+	"limiter": {map[string]float64{"threshold": -1},
+		func(sr Hertz, p map[string]float64) Effecter {
+			return NewLimiter(sr, p["threshold"])
+		}},
+}
+
+// fieldError is a validation error naming the field at fault
+func fieldError(field string, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...))
+}
+
+// names lists the keys of a map, sorted, for messages
+func names(m interface{}) string {
+	var ks []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		ks = append(ks, k.String())
+	}
+	sort.Strings(ks)
+	return strings.Join(ks, ", ")
+}
+
+// Validate checks everything makes sense, naming the first field that doesn't, and readies the preset to
+// play (so one made in code must be validated before its notes are made)
+func (p *Preset) Validate() error {
+	if p.Version != PresetVersion {
+		return fieldError("version", "is %d, expected %d", p.Version, PresetVersion)
+	}
+	if p.Name == "" {
+		return fieldError("name", "missing")
+	}
+	if err := p.Osc.setWave(); err != nil {
+		return err
+	}
+	if p.Osc.Octave < -4 || p.Osc.Octave > 4 {
+		return fieldError("osc.octave", "%d is out of range -4...4", p.Osc.Octave)
+	}
+	if u := p.Osc.Unison; u != nil {
+		if u.Voices < 1 || u.Voices > MaxUnison {
+			return fieldError("osc.unison.voices", "%d is out of range 1...%d", u.Voices, MaxUnison)
+		}
+		if u.Detune < 0 || u.Detune > 100 {
+			return fieldError("osc.unison.detune", "%g is out of range 0...100", u.Detune)
+		}
+		if _, ok := presetCurves[u.Curve]; !ok && u.Curve != "" {
+			return fieldError("osc.unison.curve", "%q is not one of %s", u.Curve, names(presetCurves))
+		}
+		if u.Spread < 0 || u.Spread > 1 {
+			return fieldError("osc.unison.spread", "%g is out of range 0...1", u.Spread)
+		}
+	}
+	if err := p.Env.validate(); err != nil {
+		return err
+	}
+	for i, f := range p.Filters {
+		if err := f.validate(fmt.Sprintf("filters[%d]", i)); err != nil {
+			return err
+		}
+	}
+	for i, e := range p.Effects {
+		if err := e.validate(fmt.Sprintf("effects[%d]", i)); err != nil {
+			return err
+		}
+	}
+	if p.Tuning.A4 < 0 || (p.Tuning.A4 > 0 && (p.Tuning.A4 < 220 || p.Tuning.A4 > 880)) {
+		return fieldError("tuning.a4", "%g is out of range 220...880", p.Tuning.A4)
+	}
+	return nil
+}
+
+func (e *EnvPreset) validate() error {
+	times := map[string]Seconds{"delay": e.Delay, "attack": e.Attack, "hold": e.Hold, "decay": e.Decay,
+		"release": e.Release, "maxSustain": e.MaxSustain, "length": e.Length, "period": e.Period, "mu": e.Mu, "sigma": e.Sigma}
+	for _, k := range []string{"delay", "attack", "hold", "decay", "release", "maxSustain", "length", "period", "mu", "sigma"} {
+		if times[k] < 0 {
+			return fieldError("env."+k, "must not be negative")
+		}
+	}
+	switch e.Type {
+	case "adsr":
+		if e.Sustain < 0 || e.Sustain > 1 {
+			return fieldError("env.sustain", "%g is out of range 0...1", e.Sustain)
+		}
+	case "triangle", "hann":
+		if e.Length <= 0 {
+			return fieldError("env.length", "needed for a %s envelope", e.Type)
+		}
+	case "gaussian":
+		if e.Length <= 0 {
+			return fieldError("env.length", "needed for a gaussian envelope")
+		}
+		if e.Sigma <= 0 {
+			return fieldError("env.sigma", "needed for a gaussian envelope")
+		}
+	default:
+		return fieldError("env.type", "%q is not one of adsr, triangle, gaussian, hann", e.Type)
+	}
+	return nil
+}
+
+func (f *FilterPreset) validate(field string) error {
+	if _, ok := presetFilters[f.Type]; !ok && f.Type != "ladder" {
+		return fieldError(field+".type", "%q is not one of %s, ladder", f.Type, names(presetFilters))
+	}
+	if f.Cutoff <= 0 || f.Cutoff > 20000 {
+		return fieldError(field+".cutoff", "%g should be above 0 and at most 20000", f.Cutoff)
+	}
+	if f.Q < 0 {
+		return fieldError(field+".q", "must not be negative")
+	}
+	if f.Res < 0 || f.Res > 1.2 {
+		return fieldError(field+".res", "%g is out of range 0...1.2", f.Res)
+	}
+	if f.Poles != 0 && (f.Type != "lowpass" && f.Type != "highpass" || f.Poles < 1 || f.Poles > 8) {
+		return fieldError(field+".poles", "only for lowpass or highpass, 1...8")
+	}
+	if f.KeyTrack < 0 || f.KeyTrack > 1 {
+		return fieldError(field+".keyTrack", "%g is out of range 0...1", f.KeyTrack)
+	}
+	return nil
+}
+
+func (e *EffectPreset) validate(field string) error {
+	pe, ok := presetEffects[e.Type]
+	if !ok {
+		return fieldError(field+".type", "%q is not one of %s", e.Type, names(presetEffects))
+	}
+	for k, v := range e.Params {
+		f := field + ".params." + k
+		if _, ok := pe.defaults[k]; !ok {
+			return fieldError(f, "%s has no such parameter (it has %s)", e.Type, names(pe.defaults))
+		}
+		switch {
+		case e.Type == "delay" && k == "mode" && (v != math.Trunc(v) || v < float64(MonoDelay) || v > float64(PingPongDelay)):
+			return fieldError(f, "%g is not one of 0 (mono), 1 (stereo), 2 (ping-pong)", v)
+		case k == "mix" && (v < 0 || v > 1):
+			return fieldError(f, "%g is out of range 0...1", v)
+		case k == "feedback" && (v <= -1 || v >= 1):
+			return fieldError(f, "%g must be between -1 and 1", v)
+		case k == "threshold" && v > 0:
+			return fieldError(f, "must not be above 0dB")
+		case k != "threshold" && k != "makeup" && k != "feedback" && v < 0:
+			return fieldError(f, "must not be negative")
+		}
+	}
+	return nil
+}
+
+// LoadPreset reads and checks a preset file
+func LoadPreset(path string) (*Preset, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePreset(b)
+	if err != nil {
+		return nil, fmt.Errorf("preset %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParsePreset reads and checks a preset
+func ParsePreset(b []byte) (*Preset, error) {
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, jsonError(b, err)
+	}
+	if v.Version == 0 {
+		return nil, fieldError("version", "missing")
+	}
+	if v.Version > PresetVersion {
+		return nil, fieldError("version", "%d is newer than this program understands (%d)", v.Version, PresetVersion)
+	}
+	p := &Preset{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, jsonError(b, err)
+	}
+	return p, p.Validate()
+}
+
+// jsonIndex finds array indices in the field paths of JSON errors, e.g. the .0 of filters.0.q
+var jsonIndex = regexp.MustCompile(`\.(\d+)`)
+
+// jsonError rewords errors decoding the JSON b to name the field (by its full path) where that is known
+func jsonError(b []byte, err error) error {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		f := jsonIndex.ReplaceAllString(e.Field, "[$1]")
+		if p, ok := jsonFind(b, f[strings.LastIndex(f, ".")+1:], false); ok {
+			f = p
+		}
+		return fieldError(f, "expected %s, found %s", e.Type, e.Value)
+	case *json.SyntaxError:
+		return fmt.Errorf("bad JSON at byte %d: %w", e.Offset, err)
+	}
+	if f := strings.TrimPrefix(err.Error(), "json: unknown field "); f != err.Error() {
+		f = strings.Trim(f, `"`)
+		if p, ok := jsonFind(b, f, true); ok {
+			f = p
+		}
+		return fieldError(f, "unknown field")
+	}
+	return err
+}
+
+// jsonFind finds the full path of the field called name in the JSON b that a Preset has no such field
+// for (if unknown), or that is of the wrong kind
+func jsonFind(b []byte, name string, unknown bool) (string, bool) {
+	var v interface{}
+	if json.Unmarshal(b, &v) != nil {
+		return "", false
+	}
+	return jsonWalk(v, reflect.TypeOf(Preset{}), "", name, unknown)
+}
+
+// jsonWalk walks JSON v alongside the type t it is decoded into, keys in order, for jsonFind
+func jsonWalk(v interface{}, t reflect.Type, path string, name string, unknown bool) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			var ft reflect.Type
+			switch t.Kind() {
+			case reflect.Struct:
+				f, ok := jsonField(t, k)
+				if !ok {
+					if unknown && k == name {
+						return p, true
+					}
+					continue
+				}
+				ft = f.Type
+			case reflect.Map:
+				ft = t.Elem()
+			default:
+				continue
+			}
+			if !unknown && k == name && !jsonFits(v[k], ft) {
+				return p, true
+			}
+			if p, ok := jsonWalk(v[k], ft, p, name, unknown); ok {
+				return p, true
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for i, e := range v {
+				if p, ok := jsonWalk(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), name, unknown); ok {
+					return p, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// jsonField is the field of struct type t that the JSON key k decodes into
+func jsonField(t reflect.Type, k string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; f.PkgPath == "" && strings.EqualFold(tag, k) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonFits is whether JSON v can be decoded into type t
+func jsonFits(v interface{}, t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case string:
+		return t.Kind() == reflect.String
+	case float64:
+		switch t.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case bool:
+		return t.Kind() == reflect.Bool
+	case []interface{}:
+		return t.Kind() == reflect.Slice
+	case map[string]interface{}:
+		return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+	}
+	return true // null fits anything
+}
+
+// Save writes the preset as JSON
+func (p *Preset) Save(path string) error {
+	p.Version = PresetVersion
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("preset %s: %w", path, err)
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// LoadPresets reads all the presets in a directory, in name order, with errors for any that are bad
+func LoadPresets(dir string) ([]*Preset, []error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	sort.Strings(files)
+	var ps []*Preset
+	var errs []error
+	for _, f := range files {
+		p, err := LoadPreset(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ps = append(ps, p)
+	}
+	return ps, errs
+}
+
+// Tune applies the preset's tuning to an equal tempered (A4 = 440Hz) frequency
+func (p *Preset) Tune(ν Hertz) Hertz {
+	a4 := p.Tuning.A4
+	if a4 == 0 {
+		a4 = 440
+	}
+	return ν * a4 / 440 * Hertz(math.Pow(2, float64(p.Tuning.Transpose)/12+p.Tuning.Cents/1200))
+}
+
+// NewNote makes a note of this instrument at frequency ν (before tuning), starting at global time t
+func (p *Preset) NewNote(t Seconds, ν Hertz, sr Hertz) *Note {
+	n, _ := p.newNote(t, ν, 1, sr)
+	return n
+}
+
+// Maker makes the preset's notes for a Player, which can glide and bend them
+func (p *Preset) Maker(sr Hertz) NoteMaker {
+	return func(t Seconds, ν Hertz, velocity float64) (*Note, Tuner) {
+		return p.newNote(t, ν, velocity, sr)
+	}
+}
+
+// newNote makes a note, and a Tuner that retunes its oscillator (keeping the octave and detune)
+func (p *Preset) newNote(t Seconds, ν Hertz, velocity float64, sr Hertz) (*Note, Tuner) {
+	ν = p.Tune(ν)
+	ratio := Hertz(math.Pow(2, float64(p.Osc.Octave)+p.Osc.Detune/1200))
+	var wave interface {
+		Osciller
+		Tuner
+	}
+	stereo := false
+	if u := p.Osc.Unison; u != nil {
+		wave = NewUnison(t, ν*ratio, p.Osc.wave, UnisonOpts{Voices: u.Voices, Detune: u.Detune,
+			Curve: presetCurves[u.Curve], Spread: u.Spread, RandomPhase: u.RandomPhase, Seed: int64(ν)})
+		stereo = u.Spread > 0
+	} else {
+		wave = NewWave(t, ν*ratio, p.Osc.wave)
+	}
+	tn := TunerFunc(func(ν Hertz) { wave.NewFreq(p.Tune(ν) * ratio) })
+	osc := withVelocity(wave, velocity)
+	if len(p.Filters) > 0 {
+		fo := NewFilteredOsc(osc, p.newFilters(ν, sr)...)
+		if stereo { // each side needs its own filters
+			fo.Right = p.newFilters(ν, sr)
+		}
+		osc = fo
+	}
+	e := p.Env
+	var env Enveloper
+	switch e.Type {
+	case "adsr":
+		env = NewADSR(t, false, e.Attack, e.Decay, Volts(e.Sustain), e.Release, e.MaxSustain, 0, 0).Delay(e.Delay).Hold(e.Hold)
+	case "triangle":
+		λ := e.Period
+		if λ == 0 {
+			λ = e.Length
+		}
+		env = NewTriangle(t, λ, e.Period > 0, e.Length)
+	case "gaussian":
+		λ := e.Period
+		if λ == 0 {
+			λ = e.Length
+		}
+		env = NewGaussian(t, λ, e.Period > 0, e.Length, e.Mu, e.Sigma)
+	case "hann":
+		env = NewHann(t, e.Length)
+	}
+	return NewNote(t, ν, env, osc), tn
+}
+
+// newFilters makes the preset's filters for a note at ν
+func (p *Preset) newFilters(ν Hertz, sr Hertz) []Filterer {
+	var filters []Filterer
+	for _, fp := range p.Filters {
+		fc := fp.Cutoff * Hertz(math.Pow(float64(ν/MiddleCfreq), fp.KeyTrack))
+		fc = Hertz(math.Min(float64(fc), 0.45*float64(sr)))
+		q := fp.Q
+		if q == 0 {
+			q = ButterworthQ
+		}
+		switch {
+		case fp.Type == "ladder":
+			filters = append(filters, NewLadder(sr, fc, fp.Res))
+		case fp.Poles > 0:
+			filters = append(filters, NewButterworth(presetFilters[fp.Type], sr, fc, fp.Poles))
+		default:
+			bq := NewBiquad(presetFilters[fp.Type], sr, fc, q)
+			bq.SetGain(fp.Gain)
+			filters = append(filters, bq)
+		}
+	}
+	return filters
+}
+
+// NewEffects makes fresh effects for the instrument's track
+func (p *Preset) NewEffects(sr Hertz) []Effecter {
+	var fx []Effecter
+	for _, ep := range p.Effects {
+		pe := presetEffects[ep.Type]
+		params := map[string]float64{}
+		for k, v := range pe.defaults {
+			params[k] = v
+		}
+		for k, v := range ep.Params {
+			params[k] = v
+		}
+		fx = append(fx, pe.make(sr, params))
+	}
+	return fx
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Bad presets are reported with the full path of the field at fault
+func TestPresetErrorPaths(t *testing.T) {
+	const head = `{"version": 1, "name": "x", "env": {"type": "adsr"}, `
+	for _, c := range []struct {
+		json string
+		want string
+	}{
+		{`"osc": {"wave": "sine", "unison": {"voices": 2, "spred": 1}}}`, "osc.unison.spred: unknown field"},
+		{`"osc": {"wave": 1}}`, "osc.wave: expected string"},
+		{`"osc": {"wave": "sine"}, "filters": [{"type": "lowpass", "cutoff": 100}, {"type": "lowpass", "cutoff": "high"}]}`,
+			"filters[1].cutoff: expected"},
+		{`"osc": {"wave": "sine"}, "filters": [{"type": "lowpass", "cutoff": 100}, {"type": "lowpass", "cutoff": 100, "gian": 3}]}`,
+			"filters[1].gian: unknown field"},
+		{`"osc": {"wave": "sine"}, "effects": [{"type": "delay", "params": {"mode": 1.5}}]}`,
+			"effects[0].params.mode: 1.5 is not one of"},
+		{`"osc": {"wave": "sine"}, "effects": [{"type": "reverb"}, {"type": "delay", "params": {"mix": "lots"}}]}`,
+			"effects[1].params.mix: expected"},
+	} {
+		_, err := ParsePreset([]byte(head + c.json))
+		if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want %s...", c.json, err, c.want)
+		}
+	}
+}
+
+// Older versions of Go only name the last field of a JSON type error; the rest of the path is found
+func TestPresetErrorPathShortField(t *testing.T) {
+	b := []byte(`{"filters": [{"cutoff": 100}, {"cutoff": "high"}]}`)
+	err := jsonError(b, &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(Hertz(0)), Field: "cutoff"})
+	if want := "filters[1].cutoff: expected"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("got %s, want %s...", err, want)
+	}
+}
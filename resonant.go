@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+)
+
+// ██████╗ ███████╗███████╗ ██████╗ ███╗   ██╗ █████╗ ███╗   ██╗████████╗
+// ██╔══██╗██╔════╝██╔════╝██╔═══██╗████╗  ██║██╔══██╗████╗  ██║╚══██╔══╝
+// ██████╔╝█████╗  ███████╗██║   ██║██╔██╗ ██║███████║██╔██╗ ██║   ██║
+// ██╔══██╗██╔══╝  ╚════██║██║   ██║██║╚██╗██║██╔══██║██║╚██╗██║   ██║
+// ██║  ██║███████╗███████║╚██████╔╝██║ ╚████║██║  ██║██║ ╚████║   ██║
+// ╚═╝  ╚═╝╚══════╝╚══════╝ ╚═════╝ ╚═╝  ╚═══╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝
+
+// Resonant filters in the style of analog synths. They stay stable when their cutoff is swept
+// every sample, so (unlike Biquad) settings take effect immediately.
+// Resonance runs from 0 (none) to 1, where the filter starts to sing on its own.
+
+// resonanceFromQ converts a Q to the 0...1 resonance scale used here
+func resonanceFromQ(q float64) float64 {
+	return math.Max(0, 1-1/(2*math.Max(q, 0.5)))
+}
+
+// Ladder is a Moog style 4 pole (24dB/octave) low pass, with a saturating stage at each pole
+type Ladder struct {
+	SR        Hertz
+	Cutoff    Hertz
+	Resonance float64 // 0...1, self oscillates from about 1
+	Drive     float64 // Gain into the stages, above 1 for growl
+	s         [4]float64
+	prevIn    float64
+}
+
+// NewLadder makes one
+func NewLadder(sr Hertz, fc Hertz, res float64) *Ladder {
+	return &Ladder{SR: sr, Cutoff: fc, Resonance: res, Drive: 1}
+}
+
+// SetCutoff is
+func (ld *Ladder) SetCutoff(f Hertz) {
+	ld.Cutoff = f
+}
+
+// SetQ sets the resonance from a Q (0.5 is none, higher Q is more resonant)
+func (ld *Ladder) SetQ(q float64) {
+	ld.Resonance = resonanceFromQ(q)
+}
+
+// Filter processes one sample, oversampling by 2 internally to keep the feedback loop accurate
+func (ld *Ladder) Filter(x Volts) Volts {
+	fc := math.Max(1, math.Min(float64(ld.Cutoff), 0.45*float64(ld.SR)))
+	g := 1 - math.Exp(-τ*fc/(2*float64(ld.SR)))
+	k := 4 * ld.Resonance
+	in := float64(x) * ld.Drive
+	for _, u := range [2]float64{(ld.prevIn + in) / 2, in} {
+		u = math.Tanh(u - k*ld.s[3])
+		t0, t1, t2 := math.Tanh(ld.s[0]), math.Tanh(ld.s[1]), math.Tanh(ld.s[2])
+		ld.s[0] += g * (u - t0)
+		ld.s[1] += g * (t0 - t1)
+		ld.s[2] += g * (t1 - t2)
+		ld.s[3] += g * (t2 - math.Tanh(ld.s[3]))
+	}
+	ld.prevIn = in
+	return Volts(ld.s[3])
+}
+
+// SVF is a 2 pole state variable filter (trapezoidal, after Simper) with a saturating integrator,
+// giving low, high, band pass or notch from the same core
+type SVF struct {
+	Type      FilterType // LowPass, HighPass, BandPass or Notch
+	SR        Hertz
+	Cutoff    Hertz
+	Resonance float64 // 0...1, self oscillates at 1
+	Drive     float64 // Gain into the filter, above 1 for growl
+	ic1, ic2  float64
+}
+
+// NewSVF makes one
+func NewSVF(kind FilterType, sr Hertz, fc Hertz, res float64) *SVF {
+	return &SVF{Type: kind, SR: sr, Cutoff: fc, Resonance: res, Drive: 1}
+}
+
+// SetCutoff is
+func (sv *SVF) SetCutoff(f Hertz) {
+	sv.Cutoff = f
+}
+
+// SetQ sets the resonance from a Q
+func (sv *SVF) SetQ(q float64) {
+	sv.Resonance = resonanceFromQ(q)
+}
+
+// Filter processes one sample
+func (sv *SVF) Filter(x Volts) Volts {
+	fc := math.Max(1, math.Min(float64(sv.Cutoff), 0.49*float64(sv.SR)))
+	g := math.Tan(π * fc / float64(sv.SR))
+	k := 2 * (1 - sv.Resonance) // damping, negative past 1 so it keeps ringing
+	if k < -0.05 {
+		k = -0.05
+	}
+	a1 := 1 / (1 + g*(g+k))
+	a2 := g * a1
+	a3 := g * a2
+	v0 := float64(x) * sv.Drive
+	v3 := v0 - sv.ic2
+	v1 := a1*sv.ic1 + a2*v3
+	v2 := sv.ic2 + a2*sv.ic1 + a3*v3
+	sv.ic1 = math.Tanh(2*v1 - sv.ic1) // saturation keeps self oscillation bounded
+	sv.ic2 = 2*v2 - sv.ic2
+	switch sv.Type {
+	case HighPass:
+		return Volts(v0 - k*v1 - v2)
+	case BandPass:
+		return Volts(v1)
+	case Notch:
+		return Volts(v0 - k*v1)
+	}
+	return Volts(v2)
+}
+
+// SweptFilter is an oscillator run through a filter whose cutoff moves with the note: following a filter
+// envelope, the velocity it was struck with, and its pitch. Modulation amounts are in octaves.
+type SweptFilter struct {
+	Src      Osciller
+	Filter   TunableFilter
+	Base     Hertz     // Cutoff with no modulation
+	Env      Enveloper // Filter envelope, may be nil
+	EnvDepth float64   // Octaves of sweep at full envelope (negative sweeps down)
+	Velocity float64   // Of the note, 0...1
+	VelDepth float64   // Octaves of sweep at full velocity
+	KeyFreq  Hertz     // Pitch of the note (Note.BaseFreq)
+	KeyTrack float64   // 0 is none, 1 moves the cutoff exactly with pitch
+	KeyRef   Hertz     // Pitch at which key tracking has no effect
+	Max      Hertz     // Highest cutoff allowed
+}
+
+// NewSweptFilter puts src through f for a note at pitch keyFreq, base being the cutoff with no modulation
+func NewSweptFilter(src Osciller, f TunableFilter, base Hertz, keyFreq Hertz) *SweptFilter {
+	return &SweptFilter{Src: src, Filter: f, Base: base, KeyFreq: keyFreq, KeyRef: MiddleCfreq, Max: 20000}
+}
+
+// Cutoff is where the filter should be at global time t
+func (sf *SweptFilter) Cutoff(t Seconds) Hertz {
+	oct := sf.VelDepth * sf.Velocity
+	if sf.Env != nil {
+		oct += sf.EnvDepth * float64(sf.Env.Amplitude(t))
+	}
+	if sf.KeyTrack != 0 && sf.KeyFreq > 0 && sf.KeyRef > 0 {
+		oct += sf.KeyTrack * math.Log2(float64(sf.KeyFreq/sf.KeyRef))
+	}
+	fc := sf.Base * Hertz(math.Pow(2, oct))
+	if fc > sf.Max {
+		fc = sf.Max
+	}
+	return fc
+}
+
+// Amplitude moves the filter and processes one sample
+func (sf *SweptFilter) Amplitude(t Seconds) Volts {
+	sf.Filter.SetCutoff(sf.Cutoff(t))
+	return sf.Filter.Filter(sf.Src.Amplitude(t))
+}
@@ -0,0 +1,153 @@
+package main
+
+// ██████╗ ███████╗██╗   ██╗███████╗██████╗ ██████╗
+// ██╔══██╗██╔════╝██║   ██║██╔════╝██╔══██╗██╔══██╗
+// ██████╔╝█████╗  ██║   ██║█████╗  ██████╔╝██████╔╝
+// ██╔══██╗██╔══╝  ╚██╗ ██╔╝██╔══╝  ██╔══██╗██╔══██╗
+// ██║  ██║███████╗ ╚████╔╝ ███████╗██║  ██║██████╔╝
+// ╚═╝  ╚═╝╚══════╝  ╚═══╝  ╚══════╝╚═╝  ╚═╝╚═════╝
+
+// Reverb is an algorithmic room, after Jezar's Freeverb: eight damped feedback combs in parallel
+// followed by four allpasses in series, for each channel. It works a block at a time, one filter over
+// the whole block before the next, which keeps the inner loops short and cache friendly.
+
+// Freeverb tunings, in samples at 44.1kHz
+var (
+	reverbCombs     = [...]int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllpasses = [...]int{556, 441, 341, 225}
+)
+
+const (
+	reverbSpread    = 23    // Extra samples for the right channel, to decorrelate it
+	reverbInputGain = 0.015 // Keeps the combs from overloading
+	reverbWetGain   = 3
+)
+
+// comb is a feedback comb filter with a low pass in the loop
+type comb struct {
+	buf      []float64
+	i        int
+	store    float64
+	feedback float64
+	damp     float64
+}
+
+// processBlock adds the comb's output for in to out
+func (c *comb) processBlock(in, out []float64) {
+	for n, x := range in {
+		y := c.buf[c.i]
+		c.store = y*(1-c.damp) + c.store*c.damp
+		c.buf[c.i] = x + c.store*c.feedback
+		c.i++
+		if c.i == len(c.buf) {
+			c.i = 0
+		}
+		out[n] += y
+	}
+}
+
+// allpass is a Schroeder allpass diffuser
+type allpass struct {
+	buf []float64
+	i   int
+}
+
+// processBlock works in place
+func (a *allpass) processBlock(io []float64) {
+	for n, x := range io {
+		y := a.buf[a.i]
+		a.buf[a.i] = x + y*0.5
+		a.i++
+		if a.i == len(a.buf) {
+			a.i = 0
+		}
+		io[n] = y - x
+	}
+}
+
+// Reverb is a stereo algorithmic reverb
+type Reverb struct {
+	SR        Hertz
+	RoomSize  float64 // 0...1, how long the tail is
+	Damping   float64 // 0...1, how quickly high frequencies die away
+	Width     float64 // 0 (mono) ... 1 (full stereo)
+	PreDelay  Seconds // Gap before the reverb starts
+	Mix       float64 // 0 all dry, 1 all wet (use 1 on a send)
+	combsL    []*comb
+	combsR    []*comb
+	allpassL  []*allpass
+	allpassR  []*allpass
+	pre       *delayLine
+	in        []float64 // Scratch, sized to the block
+	outL      []float64 //
+	outR      []float64 //
+	room      float64   // Settings the combs were last tuned to
+	damp      float64   //
+	maxPreDel Seconds
+}
+
+// NewReverb makes one for sample rate sr, allowing up to maxPreDelay of pre-delay
+func NewReverb(sr Hertz, room float64, damping float64, mix float64, maxPreDelay Seconds) *Reverb {
+	rv := &Reverb{SR: sr, RoomSize: room, Damping: damping, Width: 1, Mix: mix, maxPreDel: maxPreDelay, room: -1}
+	scale := float64(sr) / 44100
+	for _, n := range reverbCombs {
+		rv.combsL = append(rv.combsL, &comb{buf: make([]float64, int(float64(n)*scale))})
+		rv.combsR = append(rv.combsR, &comb{buf: make([]float64, int(float64(n+reverbSpread)*scale))})
+	}
+	for _, n := range reverbAllpasses {
+		rv.allpassL = append(rv.allpassL, &allpass{buf: make([]float64, int(float64(n)*scale))})
+		rv.allpassR = append(rv.allpassR, &allpass{buf: make([]float64, int(float64(n+reverbSpread)*scale))})
+	}
+	rv.pre = newDelayLine(int(float64(maxPreDelay*Seconds(sr))) + 1)
+	return rv
+}
+
+// tune passes changed room size and damping on to the combs
+func (rv *Reverb) tune() {
+	if rv.room == rv.RoomSize && rv.damp == rv.Damping {
+		return
+	}
+	rv.room, rv.damp = rv.RoomSize, rv.Damping
+	for _, cs := range [][]*comb{rv.combsL, rv.combsR} {
+		for _, c := range cs {
+			c.feedback = 0.7 + 0.28*rv.RoomSize
+			c.damp = 0.4 * rv.Damping
+		}
+	}
+}
+
+// Process is
+func (rv *Reverb) Process(samples [][2]float64) {
+	rv.tune()
+	n := len(samples)
+	if cap(rv.in) < n {
+		rv.in, rv.outL, rv.outR = make([]float64, n), make([]float64, n), make([]float64, n)
+	}
+	in, outL, outR := rv.in[:n], rv.outL[:n], rv.outR[:n]
+	pre := float64(rv.PreDelay * Seconds(rv.SR))
+	for i, s := range samples {
+		x := (s[0] + s[1]) * reverbInputGain
+		if rv.maxPreDel > 0 {
+			rv.pre.write(x)
+			x = rv.pre.read(pre + 1)
+		}
+		in[i] = x
+		outL[i], outR[i] = 0, 0
+	}
+	for i := range rv.combsL {
+		rv.combsL[i].processBlock(in, outL)
+		rv.combsR[i].processBlock(in, outR)
+	}
+	for i := range rv.allpassL {
+		rv.allpassL[i].processBlock(outL)
+		rv.allpassR[i].processBlock(outR)
+	}
+	wet1 := reverbWetGain * (rv.Width/2 + 0.5)
+	wet2 := reverbWetGain * (1 - rv.Width) / 2
+	for i := range samples {
+		l := outL[i]*wet1 + outR[i]*wet2
+		r := outR[i]*wet1 + outL[i]*wet2
+		samples[i][0] = (1-rv.Mix)*samples[i][0] + rv.Mix*l
+		samples[i][1] = (1-rv.Mix)*samples[i][1] + rv.Mix*r
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/faiface/beep/wav"
+)
+
+// ███████╗ █████╗ ███╗   ███╗██████╗ ██╗     ███████╗███████╗
+// ██╔════╝██╔══██╗████╗ ████║██╔══██╗██║     ██╔════╝██╔════╝
+// ███████╗███████║██╔████╔██║██████╔╝██║     █████╗  ███████╗
+// ╚════██║██╔══██║██║╚██╔╝██║██╔═══╝ ██║     ██╔══╝  ╚════██║
+// ███████║██║  ██║██║ ╚═╝ ██║██║     ███████╗███████╗███████║
+// ╚══════╝╚═╝  ╚═╝╚═╝     ╚═╝╚═╝     ╚══════╝╚══════╝╚══════╝
+
+// Samples are recorded sounds, read from WAV files and played back at any pitch
+
+// Sample is a recorded stereo sound held in memory
+type Sample struct {
+	Name string
+	SR   Hertz     // Rate it was recorded at
+	L, R []float64 // Left and right channels (identical for mono files)
+}
+
+// LoadSample reads a whole WAV file into memory
+func LoadSample(path string) (*Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, format, err := wav.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("sample %s: %w", path, err)
+	}
+	defer s.Close()
+	smp := &Sample{Name: path, SR: Hertz(format.SampleRate)}
+	smp.L = make([]float64, 0, s.Len())
+	smp.R = make([]float64, 0, s.Len())
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := s.Stream(buf)
+		for _, frame := range buf[:n] {
+			smp.L = append(smp.L, frame[0])
+			smp.R = append(smp.R, frame[1])
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("sample %s: %w", path, err)
+	}
+	return smp, nil
+}
+
+// Len is the number of frames in the sample
+func (smp *Sample) Len() int {
+	return len(smp.L)
+}
+
+// Duration is how long the sample lasts at its original rate
+func (smp *Sample) Duration() Seconds {
+	return Seconds(smp.Len()) / Seconds(smp.SR)
+}
+
+// Span is the range of frames available, which for a sample is all of them
+func (smp *Sample) Span() (first, last float64) {
+	return 0, float64(smp.Len() - 1)
+}
+
+// FrameRate is the rate the sample was recorded at
+func (smp *Sample) FrameRate() Hertz {
+	return smp.SR
+}
+
+// At returns the (linearly interpolated) frame at fractional position pos
+func (smp *Sample) At(pos float64) (l, r Volts) {
+	i := int(pos)
+	if pos < 0 || i >= smp.Len() {
+		return 0, 0
+	}
+	if i == smp.Len()-1 {
+		return Volts(smp.L[i]), Volts(smp.R[i])
+	}
+	frac := pos - float64(i)
+	l = Volts(smp.L[i] + frac*(smp.L[i+1]-smp.L[i]))
+	r = Volts(smp.R[i] + frac*(smp.R[i+1]-smp.R[i]))
+	return l, r
+}
+
+// LoopMode says what a SamplePlayer does when it runs off the end of its loop
+type LoopMode int
+
+// Loop modes, as in SFZ
+const (
+	NoLoop         LoopMode = iota // Play through once, stop early if released
+	OneShot                        // Play through once, ignore release
+	LoopContinuous                 // Loop forever, even after release
+	LoopSustain                    // Loop while held, play out the rest after release
+)
+
+// SamplePlayer is an oscillator that plays back a Sample, looping as required
+type SamplePlayer struct {
+	T0        Seconds // Global time when playback started
+	Smp       *Sample
+	Rate      float64 // Frames of the sample to play per second, sets the pitch
+	Offset    int     // Frame to start from
+	Loop      LoopMode
+	LoopStart int   // First frame of the loop
+	LoopEnd   int   // Last frame of the loop
+	Gain      Volts // Overall level
+	released  bool
+	relT      Seconds // When released
+	relPos    float64 // Where in the sample we were on release
+}
+
+// NewSamplePlayer returns a player of smp starting at global time t, transposed up by semitones
+func NewSamplePlayer(t Seconds, smp *Sample, semitones float64) *SamplePlayer {
+	return &SamplePlayer{
+		T0:      t,
+		Smp:     smp,
+		Rate:    float64(smp.SR) * math.Pow(2, semitones/12),
+		LoopEnd: smp.Len() - 1,
+		Gain:    1,
+	}
+}
+
+// Release lets a sustain loop play out
+func (sp *SamplePlayer) Release(t Seconds) {
+	if sp.released {
+		return
+	}
+	sp.relPos = sp.position(t)
+	sp.relT = t
+	sp.released = true
+}
+
+// position is where in the sample we are at global time t
+func (sp *SamplePlayer) position(t Seconds) float64 {
+	if sp.released && sp.Loop == LoopSustain {
+		return sp.relPos + float64(t-sp.relT)*sp.Rate
+	}
+	pos := float64(sp.Offset) + float64(t-sp.T0)*sp.Rate
+	looping := sp.Loop == LoopContinuous || sp.Loop == LoopSustain
+	loopLen := float64(sp.LoopEnd - sp.LoopStart + 1)
+	if looping && loopLen > 1 && pos > float64(sp.LoopEnd+1) {
+		pos = float64(sp.LoopStart) + math.Mod(pos-float64(sp.LoopStart), loopLen)
+	}
+	return pos
+}
+
+// Amplitude is the mono mix of the sample at global time t
+func (sp *SamplePlayer) Amplitude(t Seconds) Volts {
+	if t < sp.T0 {
+		return 0
+	}
+	l, r := sp.Smp.At(sp.position(t))
+	return sp.Gain * (l + r) / 2
+}
+
+// AmplitudeLR is the sample in stereo at global time t
+func (sp *SamplePlayer) AmplitudeLR(t Seconds) (l, r Volts) {
+	if t < sp.T0 {
+		return 0, 0
+	}
+	l, r = sp.Smp.At(sp.position(t))
+	return sp.Gain * l, sp.Gain * r
+}
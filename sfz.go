@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ███████╗███████╗███████╗
+// ██╔════╝██╔════╝╚══███╔╝
+// ███████╗█████╗    ███╔╝
+// ╚════██║██╔══╝   ███╔╝
+// ███████║██║     ███████╗
+// ╚══════╝╚═╝     ╚══════╝
+
+// SFZ is a plain text instrument format: headers like <group> and <region> followed by opcode=value pairs,
+// with the sounds themselves in WAV files alongside. See https://sfzformat.com
+
+// SFZRegion is one playable zone of an SFZ instrument, with everything it inherits already resolved
+type SFZRegion struct {
+	Line        int // Where the <region> header was
+	Sample      *Sample
+	LoKey       int
+	HiKey       int
+	KeyCenter   int     // Key at which the sample plays at its recorded pitch
+	KeyTrack    float64 // Cents per key
+	Transpose   int     // Semitones
+	Tune        float64 // Cents
+	LoVel       int
+	HiVel       int
+	SeqLength   int // Round robin length
+	SeqPosition int // Place of this region in the round robin (from 1)
+	Loop        LoopMode
+	LoopStart   int
+	LoopEnd     int
+	Offset      int
+	Volume      float64 // dB
+	VelTrack    float64 // Percent
+	Delay       Seconds // ampeg_delay
+	Attack      Seconds // ampeg_attack
+	Hold        Seconds // ampeg_hold
+	Decay       Seconds // ampeg_decay
+	Sustain     float64 // ampeg_sustain, percent
+	Release     Seconds // ampeg_release
+}
+
+// SFZInstrument is a set of regions loaded from an SFZ file
+type SFZInstrument struct {
+	Name     string
+	Regions  []*SFZRegion
+	seqCount map[int]int // Round robin counter for each key
+}
+
+// sfzScope is the set of opcodes defined at one level of header
+type sfzScope map[string]string
+
+var (
+	sfzToken  = regexp.MustCompile(`<(\w+)>|([A-Za-z0-9_]+)=`)
+	sfzDefine = regexp.MustCompile(`^#define\s+(\$\w+)\s+(.*)$`)
+	sfzInc    = regexp.MustCompile(`^#include\s+"([^"]+)"`)
+	sfzBlock  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// LoadSFZ reads an SFZ file and all the samples it mentions
+func LoadSFZ(path string) (*SFZInstrument, error) {
+	lines, err := readSFZLines(path, map[string]string{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	inst := &SFZInstrument{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), seqCount: map[int]int{}}
+	samples := map[string]*Sample{}
+	control, global, master, group := sfzScope{}, sfzScope{}, sfzScope{}, sfzScope{}
+	var region sfzScope
+	current := control // where opcodes are going
+	regionLine := 0
+	var regionFile string
+
+	finish := func() error {
+		if region == nil {
+			return nil
+		}
+		r, err := newSFZRegion(region, control, regionLine, filepath.Dir(regionFile), samples)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", regionFile, regionLine, err)
+		}
+		inst.Regions = append(inst.Regions, r)
+		region = nil
+		return nil
+	}
+
+	for _, ln := range lines {
+		matches := sfzToken.FindAllStringSubmatchIndex(ln.text, -1)
+		for i, m := range matches {
+			if m[2] >= 0 { // a header
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				switch hdr := ln.text[m[2]:m[3]]; hdr {
+				case "control":
+					current = control
+				case "global":
+					global, master, group = sfzScope{}, sfzScope{}, sfzScope{}
+					current = global
+				case "master":
+					master, group = sfzScope{}, sfzScope{}
+					current = master
+				case "group":
+					group = sfzScope{}
+					current = group
+				case "region":
+					region = sfzScope{}
+					for _, parent := range []sfzScope{global, master, group} {
+						for k, v := range parent {
+							region[k] = v
+						}
+					}
+					regionLine, regionFile = ln.num, ln.file
+					current = region
+				default:
+					fmt.Printf("SFZ: %s:%d: ignoring unsupported header <%s>\n", ln.file, ln.num, hdr)
+					current = sfzScope{}
+				}
+				continue
+			}
+			// an opcode, whose value runs up to the next token
+			end := len(ln.text)
+			if i+1 < len(matches) {
+				end = matches[i+1][0]
+			}
+			op := ln.text[m[4]:m[5]]
+			val := strings.TrimSpace(ln.text[m[1]:end])
+			if op != "sample" && op != "default_path" {
+				if f := strings.Fields(val); len(f) > 0 {
+					val = f[0]
+				}
+			}
+			current[op] = val
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(inst.Regions) == 0 {
+		return nil, fmt.Errorf("sfz %s: no regions", path)
+	}
+	return inst, nil
+}
+
+// sfzLine is one line of SFZ text, stripped of comments and with #defines applied
+type sfzLine struct {
+	file string
+	num  int
+	text string
+}
+
+// readSFZLines reads a file, following #include and applying #define as it goes
+func readSFZLines(path string, defines map[string]string, depth int) ([]sfzLine, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("sfz %s: includes nested too deeply", path)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// blank out block comments, but keep their newlines so line numbers still work
+	text := sfzBlock.ReplaceAllStringFunc(string(raw), func(c string) string {
+		return strings.Repeat("\n", strings.Count(c, "\n"))
+	})
+	var lines []sfzLine
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for num := 1; sc.Scan(); num++ {
+		t := sc.Text()
+		if i := strings.Index(t, "//"); i >= 0 {
+			t = t[:i]
+		}
+		t = strings.TrimSpace(t)
+		if m := sfzDefine.FindStringSubmatch(t); m != nil {
+			defines[m[1]] = strings.TrimSpace(m[2])
+			continue
+		}
+		if m := sfzInc.FindStringSubmatch(t); m != nil {
+			inc, err := readSFZLines(filepath.Join(filepath.Dir(path), filepath.FromSlash(m[1])), defines, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, num, err)
+			}
+			lines = append(lines, inc...)
+			continue
+		}
+		t = sfzReplacer(defines).Replace(t)
+		if t != "" {
+			lines = append(lines, sfzLine{file: path, num: num, text: t})
+		}
+	}
+	return lines, sc.Err()
+}
+
+// sfzReplacer applies #defines, longest name first (then in name order), so $A doesn't replace the start
+// of $AB, and in one pass, so what one is defined as isn't itself replaced
+func sfzReplacer(defines map[string]string) *strings.Replacer {
+	names := make([]string, 0, len(defines))
+	for k := range defines {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	var pairs []string
+	for _, k := range names {
+		pairs = append(pairs, k, defines[k])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// newSFZRegion makes sense of the opcodes of one region, loading its sample if not already seen
+func newSFZRegion(ops sfzScope, control sfzScope, line int, dir string, samples map[string]*Sample) (*SFZRegion, error) {
+	p := sfzParser{ops: ops}
+	keyShift := 0
+	if control["note_offset"] != "" || control["octave_offset"] != "" {
+		cp := sfzParser{ops: control}
+		keyShift = cp.int("note_offset", 0) + 12*cp.int("octave_offset", 0)
+	}
+	r := &SFZRegion{
+		Line:        line,
+		LoKey:       p.key("lokey", 0),
+		HiKey:       p.key("hikey", 127),
+		KeyCenter:   p.key("pitch_keycenter", 60),
+		KeyTrack:    p.float("pitch_keytrack", 100),
+		Transpose:   p.int("transpose", 0),
+		Tune:        p.float("tune", 0),
+		LoVel:       p.int("lovel", 0),
+		HiVel:       p.int("hivel", 127),
+		SeqLength:   p.int("seq_length", 1),
+		SeqPosition: p.int("seq_position", 1),
+		Offset:      p.int("offset", 0),
+		Volume:      p.float("volume", 0),
+		VelTrack:    p.float("amp_veltrack", 100),
+		Delay:       Seconds(p.float("ampeg_delay", 0)),
+		Attack:      Seconds(p.float("ampeg_attack", 0)),
+		Hold:        Seconds(p.float("ampeg_hold", 0)),
+		Decay:       Seconds(p.float("ampeg_decay", 0)),
+		Sustain:     p.float("ampeg_sustain", 100),
+		Release:     Seconds(p.float("ampeg_release", 0)),
+	}
+	if _, ok := ops["key"]; ok {
+		k := p.key("key", 60)
+		r.LoKey, r.HiKey, r.KeyCenter = k, k, k
+	}
+	r.LoKey += keyShift
+	r.HiKey += keyShift
+	r.KeyCenter += keyShift
+	switch mode := ops["loop_mode"]; mode {
+	case "", "no_loop":
+		r.Loop = NoLoop
+	case "one_shot":
+		r.Loop = OneShot
+	case "loop_continuous":
+		r.Loop = LoopContinuous
+	case "loop_sustain":
+		r.Loop = LoopSustain
+	default:
+		p.fail("loop_mode", mode)
+	}
+	if r.SeqLength < 1 || r.SeqPosition < 1 || r.SeqPosition > r.SeqLength {
+		p.fail("seq_position", ops["seq_position"])
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	name := ops["sample"]
+	if name == "" {
+		return nil, fmt.Errorf("region has no sample")
+	}
+	path := filepath.Join(dir, filepath.FromSlash(strings.Replace(control["default_path"]+name, `\`, "/", -1)))
+	smp, ok := samples[path]
+	if !ok {
+		var err error
+		if smp, err = LoadSample(path); err != nil {
+			return nil, err
+		}
+		samples[path] = smp
+	}
+	r.Sample = smp
+	r.LoopStart = p.int("loop_start", 0)
+	r.LoopEnd = p.int("loop_end", smp.Len()-1)
+	if r.LoopEnd >= smp.Len() || r.LoopStart > r.LoopEnd {
+		p.fail("loop_end", ops["loop_end"])
+	}
+	return r, p.err
+}
+
+// sfzParser reads typed values out of a scope, remembering the first thing that was wrong
+type sfzParser struct {
+	ops sfzScope
+	err error
+}
+
+func (p *sfzParser) fail(op, val string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("bad value %q for %s", val, op)
+	}
+}
+
+func (p *sfzParser) float(op string, dflt float64) float64 {
+	s, ok := p.ops[op]
+	if !ok {
+		return dflt
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.fail(op, s)
+		return dflt
+	}
+	return f
+}
+
+func (p *sfzParser) int(op string, dflt int) int {
+	return int(p.float(op, float64(dflt)))
+}
+
+// key reads either a MIDI key number or a note name like c#4 (c4 being middle C, 60)
+func (p *sfzParser) key(op string, dflt int) int {
+	s, ok := p.ops[op]
+	if !ok {
+		return dflt
+	}
+	if k, err := strconv.Atoi(s); err == nil {
+		return k
+	}
+	if k, ok := sfzNoteKey(s); ok {
+		return k
+	}
+	p.fail(op, s)
+	return dflt
+}
+
+// sfzNoteKey converts a note name to a MIDI key number
+func sfzNoteKey(s string) (int, bool) {
+	s = strings.ToLower(s)
+	if len(s) < 2 {
+		return 0, false
+	}
+	k := strings.IndexByte("c d ef g a b", s[0])
+	if k < 0 || s[0] == ' ' {
+		return 0, false
+	}
+	s = s[1:]
+	switch s[0] {
+	case '#':
+		k++
+		s = s[1:]
+	case 'b':
+		k--
+		s = s[1:]
+	}
+	oct, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return (oct+1)*12 + k, true
+}
+
+// Matches says whether the region should sound for this key and velocity
+func (r *SFZRegion) Matches(key, vel int) bool {
+	return key >= r.LoKey && key <= r.HiKey && vel >= r.LoVel && vel <= r.HiVel
+}
+
+// NewNote makes a note playing this region, starting at global time t
+func (r *SFZRegion) NewNote(t Seconds, key, vel int) *Note {
+	semis := float64(key-r.KeyCenter)*r.KeyTrack/100 + float64(r.Transpose) + r.Tune/100
+	osc := NewSamplePlayer(t, r.Sample, semis)
+	osc.Offset = r.Offset
+	osc.Loop = r.Loop
+	osc.LoopStart, osc.LoopEnd = r.LoopStart, r.LoopEnd
+	v := float64(vel) / 127
+	velGain := 1 - r.VelTrack/100*(1-v*v)
+	osc.Gain = Volts(velGain * math.Pow(10, r.Volume/20))
+
+	// one shots sustain until the sample runs out, otherwise we wait for a release
+	ts := Seconds(0)
+	if r.Loop == OneShot {
+		playLen := Seconds(float64(r.Sample.Len()-r.Offset) / osc.Rate)
+		ts = max(playLen-r.Delay-r.Attack-r.Hold-r.Decay, 2*PlanckTime)
+	}
+	env := NewADSR(t, false, r.Attack, r.Decay, Volts(r.Sustain/100), r.Release, 0, 0, ts).Delay(r.Delay).Hold(r.Hold)
+	return NewNote(t, KeyFreq(key), env, osc)
+}
+
+// Notes makes the notes for every region that should sound when key is struck with velocity vel (0-127)
+func (inst *SFZInstrument) Notes(t Seconds, key, vel int) []*Note {
+	count := inst.seqCount[key]
+	inst.seqCount[key] = count + 1
+	notes := []*Note{}
+	for _, r := range inst.Regions {
+		if r.Matches(key, vel) && count%r.SeqLength == r.SeqPosition-1 {
+			notes = append(notes, r.NewNote(t, key, vel))
+		}
+	}
+	return notes
+}
+
+// Play adds the notes for a key to the synth, returning the sounds so they can be released later
+func (inst *SFZInstrument) Play(syn *Synth, t Seconds, key, vel int) []*Sound {
+	sounds := []*Sound{}
+	for _, n := range inst.Notes(t, key, vel) {
+		sounds = append(sounds, syn.AddSound(n, t))
+	}
+	return sounds
+}
@@ -0,0 +1,277 @@
+package main
+
+import "math"
+
+// ███████╗██╗ ██████╗ ███╗   ██╗ █████╗ ██╗
+// ██╔════╝██║██╔════╝ ████╗  ██║██╔══██╗██║
+// ███████╗██║██║  ███╗██╔██╗ ██║███████║██║
+// ╚════██║██║██║   ██║██║╚██╗██║██╔══██║██║
+// ███████║██║╚██████╔╝██║ ╚████║██║  ██║███████╗
+// ╚══════╝╚═╝ ╚═════╝ ╚═╝  ╚═══╝╚═╝  ╚═╝╚══════╝
+
+// Envelopes and oscillators are both just Volts as a function of time, so both are Signals. A Sig wraps
+// any Signal, starting at a global time, so it can be combined with others, e.g.
+//
+//   NewSig(t, NewSine(t, 5)).Scale(0.3).Offset(0.7).Mul(env).Then(tail).Stretch(2)
+//
+// and a Sig is an Osciller, an Enveloper (and Releaser) and a ModSource, so can go anywhere they can.
+// Lengths are durations from the start, as for envelopes; a Signal that isn't an envelope lasts forever
+// (MaxNoteLen). Delay, Stretch and Then play their signals at other times, which must still only go forward.
+
+// Signal is anything with a level at global time t
+type Signal interface {
+	Amplitude(t Seconds) Volts
+}
+
+// Sig is a Signal that can be combined with others
+type Sig struct {
+	T0      Seconds // Global time it starts
+	amp     func(t Seconds) Volts
+	length  func() Seconds
+	release func(t Seconds)
+}
+
+// NewSig wraps a Signal starting at global time t (if it isn't a Sig already)
+func NewSig(t Seconds, s Signal) *Sig {
+	if sg, ok := s.(*Sig); ok {
+		return sg
+	}
+	sg := &Sig{T0: t, amp: s.Amplitude, length: func() Seconds { return MaxNoteLen }, release: func(t Seconds) {}}
+	if e, ok := s.(Enveloper); ok {
+		sg.length = e.Length
+	}
+	if r, ok := s.(Releaser); ok {
+		sg.release = r.Release
+	}
+	return sg
+}
+
+// Const is a steady level, forever
+func Const(v Volts) *Sig {
+	return NewSig(0, SigFunc(func(t Seconds) Volts { return v }))
+}
+
+// SigFunc lets a function be a Signal
+type SigFunc func(t Seconds) Volts
+
+// Amplitude is
+func (sf SigFunc) Amplitude(t Seconds) Volts {
+	return sf(t)
+}
+
+// Amplitude is
+func (sg *Sig) Amplitude(t Seconds) Volts {
+	return sg.amp(t)
+}
+
+// Length is
+func (sg *Sig) Length() Seconds {
+	return sg.length()
+}
+
+// Release releases everything it is made of
+func (sg *Sig) Release(t Seconds) {
+	sg.release(t)
+}
+
+// Value lets it be a modulation source
+func (sg *Sig) Value(t Seconds) float64 {
+	return float64(sg.amp(t))
+}
+
+// sigs wraps several, all starting at t
+func sigs(t Seconds, ss []Signal) []*Sig {
+	out := make([]*Sig, len(ss))
+	for i, s := range ss {
+		out[i] = NewSig(t, s)
+	}
+	return out
+}
+
+// forever caps a length at MaxNoteLen, which is as long as things last
+func forever(l Seconds) Seconds {
+	return min(l, MaxNoteLen)
+}
+
+// releaseAll releases each at the same time
+func releaseAll(ss []*Sig) func(t Seconds) {
+	return func(t Seconds) {
+		for _, s := range ss {
+			s.release(t)
+		}
+	}
+}
+
+// Sum adds signals starting at global time t; it lasts as long as the longest
+func Sum(t Seconds, ss ...Signal) *Sig {
+	in := sigs(t, ss)
+	return &Sig{
+		T0: t,
+		amp: func(t Seconds) Volts {
+			var a Volts
+			for _, s := range in {
+				a += s.amp(t)
+			}
+			return a
+		},
+		length: func() Seconds {
+			var l Seconds
+			for _, s := range in {
+				l = max(l, s.length())
+			}
+			return l
+		},
+		release: releaseAll(in),
+	}
+}
+
+// Product multiplies signals starting at global time t (so one can shape or gate another); it lasts as
+// long as the shortest
+func Product(t Seconds, ss ...Signal) *Sig {
+	in := sigs(t, ss)
+	return &Sig{
+		T0: t,
+		amp: func(t Seconds) Volts {
+			a := Volts(1)
+			for _, s := range in {
+				a *= s.amp(t)
+			}
+			return a
+		},
+		length: func() Seconds {
+			l := MaxNoteLen
+			for _, s := range in {
+				l = min(l, s.length())
+			}
+			return l
+		},
+		release: releaseAll(in),
+	}
+}
+
+// Sequence plays signals one after another from global time t, each for its length. Each is made as if
+// starting at t, and played later.
+func Sequence(t Seconds, ss ...Signal) *Sig {
+	in := sigs(t, ss)
+	// where is the part playing at local time lt, and when it started
+	where := func(lt Seconds) (*Sig, Seconds) {
+		var at Seconds
+		for _, s := range in {
+			l := s.length()
+			if lt < at+l {
+				return s, at
+			}
+			at += l
+		}
+		return nil, 0
+	}
+	t0 := t
+	return &Sig{
+		T0: t,
+		amp: func(t Seconds) Volts {
+			s, at := where(t - t0)
+			if s == nil {
+				return 0
+			}
+			return s.amp(t - at)
+		},
+		length: func() Seconds {
+			var l Seconds
+			for _, s := range in {
+				l += s.length()
+			}
+			return forever(l)
+		},
+		release: func(t Seconds) {
+			if s, at := where(t - t0); s != nil {
+				s.release(t - at)
+			}
+		},
+	}
+}
+
+// Add is the sum of this and others
+func (sg *Sig) Add(ss ...Signal) *Sig {
+	return Sum(sg.T0, append([]Signal{sg}, ss...)...)
+}
+
+// Mul is the product of this and others
+func (sg *Sig) Mul(ss ...Signal) *Sig {
+	return Product(sg.T0, append([]Signal{sg}, ss...)...)
+}
+
+// Then is this followed by others
+func (sg *Sig) Then(ss ...Signal) *Sig {
+	return Sequence(sg.T0, append([]Signal{sg}, ss...)...)
+}
+
+// Scale multiplies it by k
+func (sg *Sig) Scale(k float64) *Sig {
+	return &Sig{
+		T0:      sg.T0,
+		amp:     func(t Seconds) Volts { return Volts(k) * sg.amp(t) },
+		length:  sg.length,
+		release: sg.release,
+	}
+}
+
+// Offset adds v to it, e.g. to turn a -1...+1 oscillator into a 0...1 control
+func (sg *Sig) Offset(v Volts) *Sig {
+	return &Sig{
+		T0:      sg.T0,
+		amp:     func(t Seconds) Volts { return sg.amp(t) + v },
+		length:  sg.length,
+		release: sg.release,
+	}
+}
+
+// Clamp limits it to lo...hi
+func (sg *Sig) Clamp(lo, hi Volts) *Sig {
+	return &Sig{
+		T0:      sg.T0,
+		amp:     func(t Seconds) Volts { return Volts(math.Max(float64(lo), math.Min(float64(hi), float64(sg.amp(t))))) },
+		length:  sg.length,
+		release: sg.release,
+	}
+}
+
+// Delay plays it d later (silent until then)
+func (sg *Sig) Delay(d Seconds) *Sig {
+	return &Sig{
+		T0: sg.T0,
+		amp: func(t Seconds) Volts {
+			if t-sg.T0 < d {
+				return 0
+			}
+			return sg.amp(t - d)
+		},
+		length:  func() Seconds { return forever(d + sg.length()) },
+		release: func(t Seconds) { sg.release(t - d) },
+	}
+}
+
+// Stretch plays it k times slower (faster if k < 1)
+func (sg *Sig) Stretch(k float64) *Sig {
+	at := func(t Seconds) Seconds { return sg.T0 + (t-sg.T0)/Seconds(k) }
+	return &Sig{
+		T0:      sg.T0,
+		amp:     func(t Seconds) Volts { return sg.amp(at(t)) },
+		length:  func() Seconds { return forever(Seconds(k) * sg.length()) },
+		release: func(t Seconds) { sg.release(at(t)) },
+	}
+}
+
+// Fade cross-fades from this to other as x goes from 0 to 1 (x is often an envelope); it lasts as long as
+// the longer of the two
+func (sg *Sig) Fade(other Signal, x Signal) *Sig {
+	b, mix := NewSig(sg.T0, other), NewSig(sg.T0, x)
+	return &Sig{
+		T0: sg.T0,
+		amp: func(t Seconds) Volts {
+			m := Volts(math.Max(0, math.Min(1, float64(mix.amp(t)))))
+			return (1-m)*sg.amp(t) + m*b.amp(t)
+		},
+		length:  func() Seconds { return max(sg.length(), b.length()) },
+		release: releaseAll([]*Sig{sg, b, mix}),
+	}
+}
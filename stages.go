@@ -0,0 +1,234 @@
+package main
+
+// ███████╗████████╗ █████╗  ██████╗ ███████╗███████╗
+// ██╔════╝╚══██╔══╝██╔══██╗██╔════╝ ██╔════╝██╔════╝
+// ███████╗   ██║   ███████║██║  ███╗█████╗  ███████╗
+// ╚════██║   ██║   ██╔══██║██║   ██║██╔══╝  ╚════██║
+// ███████║   ██║   ██║  ██║╚██████╔╝███████╗███████║
+// ╚══════╝   ╚═╝   ╚═╝  ╚═╝ ╚═════╝ ╚══════╝╚══════╝
+
+// Stages come in four sorts: sources (oscillators, samples), filters (filters, envelopes used as VCAs),
+// sinks (Channel) and utilities (Freq). Oscillators, envelopes and filters become stages by wrapping.
+
+// Tuner is anything whose pitch can be changed while it plays
+type Tuner interface {
+	NewFreq(ν Hertz)
+}
+
+// OscStage is an oscillator as a stage; it has a freq input if the oscillator can be retuned
+type OscStage struct {
+	Osciller
+}
+
+// NewOscStage wraps one
+func NewOscStage(o Osciller) *OscStage {
+	return &OscStage{Osciller: o}
+}
+
+// Inputs are
+func (st *OscStage) Inputs() []Port {
+	if _, ok := st.Osciller.(Tuner); !ok {
+		return nil
+	}
+	ν := Hertz(0) // leave the frequency alone if nothing is wired in
+	if o, ok := st.Osciller.(*Oscillator); ok {
+		ν = o.Freq()
+	}
+	return []Port{{Name: "freq", Kind: FreqPort, Default: float64(ν)}}
+}
+
+// Outputs are
+func (st *OscStage) Outputs() []Port {
+	return []Port{{Name: "out", Kind: AudioPort}}
+}
+
+// Process is
+func (st *OscStage) Process(t Seconds, in []float64, out []float64) {
+	if tn, ok := st.Osciller.(Tuner); ok && len(in) > 0 && in[0] > 0 {
+		tn.NewFreq(Hertz(in[0]))
+	}
+	out[0] = float64(st.Amplitude(t))
+}
+
+// Release passes on to the oscillator
+func (st *OscStage) Release(t Seconds) {
+	if r, ok := st.Osciller.(Releaser); ok {
+		r.Release(t)
+	}
+}
+
+// EnvStage is an envelope as a stage: its level comes out of "level", and "in" times the level out of "out"
+type EnvStage struct {
+	Enveloper
+}
+
+// NewEnvStage wraps one
+func NewEnvStage(e Enveloper) *EnvStage {
+	return &EnvStage{Enveloper: e}
+}
+
+// Inputs are
+func (es *EnvStage) Inputs() []Port {
+	return []Port{{Name: "in", Kind: AudioPort, Default: 1}}
+}
+
+// Outputs are
+func (es *EnvStage) Outputs() []Port {
+	return []Port{{Name: "out", Kind: AudioPort}, {Name: "level", Kind: ControlPort}}
+}
+
+// Process is
+func (es *EnvStage) Process(t Seconds, in []float64, out []float64) {
+	e := float64(es.Amplitude(t))
+	out[0], out[1] = in[0]*e, e
+}
+
+// Release passes on to the envelope
+func (es *EnvStage) Release(t Seconds) {
+	if r, ok := es.Enveloper.(Releaser); ok {
+		r.Release(t)
+	}
+}
+
+// FilterStage is a filter as a stage; tunable filters also have cutoff and q inputs
+type FilterStage struct {
+	Filterer
+}
+
+// NewFilterStage wraps one
+func NewFilterStage(f Filterer) *FilterStage {
+	return &FilterStage{Filterer: f}
+}
+
+// Inputs are
+func (fs *FilterStage) Inputs() []Port {
+	ports := []Port{{Name: "in", Kind: AudioPort}}
+	if _, ok := fs.Filterer.(TunableFilter); ok { // 0 leaves the setting alone
+		ports = append(ports, Port{Name: "cutoff", Kind: FreqPort}, Port{Name: "q", Kind: ControlPort})
+	}
+	return ports
+}
+
+// Outputs are
+func (fs *FilterStage) Outputs() []Port {
+	return []Port{{Name: "out", Kind: AudioPort}}
+}
+
+// Process is
+func (fs *FilterStage) Process(t Seconds, in []float64, out []float64) {
+	if tf, ok := fs.Filterer.(TunableFilter); ok {
+		if in[1] > 0 {
+			tf.SetCutoff(Hertz(in[1]))
+		}
+		if in[2] > 0 {
+			tf.SetQ(in[2])
+		}
+	}
+	out[0] = float64(fs.Filter(Volts(in[0])))
+}
+
+// FreqStage puts out a fixed frequency, e.g. the note's own or MiddleCfreq
+type FreqStage struct {
+	ν Hertz
+}
+
+// NewFreqStage makes one
+func NewFreqStage(ν Hertz) *FreqStage {
+	return &FreqStage{ν: ν}
+}
+
+// Inputs are
+func (fs *FreqStage) Inputs() []Port {
+	return nil
+}
+
+// Outputs are
+func (fs *FreqStage) Outputs() []Port {
+	return []Port{{Name: "freq", Kind: FreqPort}}
+}
+
+// Process is
+func (fs *FreqStage) Process(t Seconds, in []float64, out []float64) {
+	out[0] = float64(fs.ν)
+}
+
+// Side is where a Channel sends its signal
+type Side int
+
+// Sides
+const (
+	Centre Side = iota // Both channels
+	Left
+	Right
+)
+
+// ChannelStage is a sink, sending whatever reaches it out of the voice
+type ChannelStage struct {
+	Side Side
+	v    float64
+}
+
+// NewChannelStage makes one
+func NewChannelStage(side Side) *ChannelStage {
+	return &ChannelStage{Side: side}
+}
+
+// Inputs are
+func (cs *ChannelStage) Inputs() []Port {
+	return []Port{{Name: "in", Kind: AudioPort}}
+}
+
+// Outputs are
+func (cs *ChannelStage) Outputs() []Port {
+	return nil
+}
+
+// Process is
+func (cs *ChannelStage) Process(t Seconds, in []float64, out []float64) {
+	cs.v = in[0]
+}
+
+// Levels is what it sent to each side for the last sample
+func (cs *ChannelStage) Levels() (l, r Volts) {
+	switch cs.Side {
+	case Left:
+		return Volts(cs.v), 0
+	case Right:
+		return 0, Volts(cs.v)
+	}
+	return Volts(cs.v), Volts(cs.v)
+}
+
+// WaveStage plays a wave expression, with a freq input and a control input for each of its parameters
+type WaveStage struct {
+	*WaveOsc
+	Ratio float64 // Of the frequency it plays to its freq input, e.g. 2.76 for a partial of a bell
+}
+
+// NewWaveStage makes one playing ratio times ν, starting at global time t
+func NewWaveStage(t Seconds, ν Hertz, ratio float64, we *WaveExpr) *WaveStage {
+	return &WaveStage{WaveOsc: NewWaveOsc(t, ν*Hertz(ratio), we), Ratio: ratio}
+}
+
+// Inputs are
+func (ws *WaveStage) Inputs() []Port {
+	ports := []Port{{Name: "freq", Kind: FreqPort, Default: float64(ws.Freq()) / ws.Ratio}}
+	for i, name := range ws.Expr.names {
+		ports = append(ports, Port{Name: name, Kind: ControlPort, Default: ws.Expr.vals[i]})
+	}
+	return ports
+}
+
+// Outputs are
+func (ws *WaveStage) Outputs() []Port {
+	return []Port{{Name: "out", Kind: AudioPort}}
+}
+
+// Process is
+func (ws *WaveStage) Process(t Seconds, in []float64, out []float64) {
+	if in[0] > 0 {
+		ws.NewFreq(Hertz(in[0] * ws.Ratio))
+	}
+	copy(ws.Expr.vals, in[1:])
+	out[0] = float64(ws.Oscillator.Amplitude(t))
+}
@@ -6,6 +6,7 @@ import (
 	"image/png"
 	"math"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -18,16 +19,20 @@ import (
 
 // Synth is
 type Synth struct {
-	T0         time.Time // When this synth started playing
-	SampleNo   int       // number of the last sample emitted
-	Freq       Hertz     // Hz
-	SR         Hertz     // Samples/Second
-	Tick       Seconds   // Seconds/Sample
-	DeltaPhase Angle     // Radians/Sample
-	Sounds     []*Sound  // Sounds being considered for playing
+	T0         time.Time   // When this synth started playing
+	SampleNo   int         // number of the last sample emitted
+	Freq       Hertz       // Hz
+	SR         Hertz       // Samples/Second
+	Tick       Seconds     // Seconds/Sample
+	DeltaPhase Angle       // Radians/Sample
+	Sounds     []*Sound    // Sounds being considered for playing (guarded by mu)
+	Effects    []Effecter  // Master inserts, applied in order to the sum of the sounds
+	Live       *LiveBuffer // If set, keeps the most recent output (e.g. for granulating)
+	Mixer      *Mixer      // Tracks and buses the sounds are mixed through
 	recordingL []float64
 	recordingR []float64
 	recordIt   bool
+	mu         sync.Mutex // Held while sounds are added, and while they are mixed
 }
 
 // Sound is a note played at a particular time
@@ -35,6 +40,7 @@ type Sound struct {
 	*Note
 	Start Seconds
 	End   Seconds
+	Track string // Mixer track it plays through
 }
 
 // Amplitude is just that of the underlying note
@@ -42,10 +48,17 @@ func (snd Sound) Amplitude(t Seconds) Volts {
 	return snd.Note.Amplitude(t)
 }
 
+// Release lets go of the sound at global time t, so it ends once its note has died away
+func (snd *Sound) Release(t Seconds) {
+	snd.Note.Release(t)
+	snd.End = snd.Start + snd.Note.Length()
+}
+
 // NewSynth makes and inits a new one
 func NewSynth(t0 time.Time, f Hertz, sr Hertz) *Synth {
 	syn := Synth{T0: t0, Freq: f, SR: sr}
 	syn.Tick = Seconds(1 / sr)
+	syn.Mixer = NewMixer()
 	syn.recordingL = make([]float64, 0, 1000000)
 	syn.recordingR = make([]float64, 0, 1000000)
 	return &syn
@@ -53,71 +66,161 @@ func NewSynth(t0 time.Time, f Hertz, sr Hertz) *Synth {
 
 // Now is the current 'Global Time' of the synth in Seconds since starting
 // Sounds that wish to start immediately should do so at syn.Now()
-func (syn Synth) Now() Seconds {
+func (syn *Synth) Now() Seconds {
 	return Seconds(float64(time.Now().Sub(syn.T0)) / float64(time.Second))
 	// return syn.lastAt + syn.Tick
 }
 
-// AddSound adds a note to be played starting at time 'when'
-func (syn *Synth) AddSound(n *Note, start Seconds) {
+// AddSound adds a note to be played starting at time 'when', on the main track
+func (syn *Synth) AddSound(n *Note, start Seconds) *Sound {
+	return syn.AddSoundTo(n, start, MainTrack)
+}
+
+// AddSoundTo adds a note to be played through the named mixer track
+func (syn *Synth) AddSoundTo(n *Note, start Seconds, track string) *Sound {
 	//	fmt.Printf("Playing sound from %f to %f\n", start, start+n.Length())
-	ns := &Sound{Note: n, Start: start, End: start + n.Length()}
+	ns := &Sound{Note: n, Start: start, End: start + n.Length(), Track: track}
+	syn.mu.Lock()
 	syn.Sounds = append(syn.Sounds, ns)
+	syn.mu.Unlock()
 	//	sort.Slice(syn.Sounds, func(i, j int) bool { return syn.Sounds[i].End < syn.Sounds[j].End })
+	return ns
 }
 
-// Amplitude adds all the currently playing notes together, culls any that have completed
+// Amplitude adds all the currently playing notes together, clamped to +-1
 func (syn *Synth) Amplitude(t Seconds) Volts {
+	return clip(syn.Sum(t))
+}
+
+// Sum adds all the currently playing notes together, without clamping (so effects see the true level)
+func (syn *Synth) Sum(t Seconds) Volts {
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
 	a := Volts(0.0)
-	n := 0
 	for _, s := range syn.Sounds {
 		if s.Start <= t && s.End >= t {
 			a += s.Amplitude(t)
-			n++
 		}
 	}
-	if n > 0 {
-		if math.Abs(float64(a)) > 1 { // clamp to +-1
-			if math.Signbit(float64(a)) {
-				return -1
+	return a
+}
+
+// Sounding lists the keys of the notes playing at global time t, from whatever played them
+func (syn *Synth) Sounding(t Seconds) []int {
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
+	var keys []int
+	for _, s := range syn.Sounds {
+		if s.Start > t || s.End < t {
+			continue
+		}
+		ν := s.BaseFreq
+		switch o := s.Osc.(type) {
+		case *Glider: // it may have glided off
+			ν = o.FreqAt(t)
+		case *Theremin:
+			if f, on := o.Pitch(); on {
+				ν = f
+			} else {
+				ν = 0
 			}
-			return 1
 		}
-		return a // its ok, in range -1...+1
+		if ν > 0 {
+			keys = append(keys, FreqKey(ν))
+		}
 	}
-	return 0.0 // dead air
+	return keys
 }
 
-// PruneSounds removes any from the list that have finished playing
+// SoundCount is how many sounds are being considered for playing
+func (syn *Synth) SoundCount() int {
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
+	return len(syn.Sounds)
+}
+
+// clip clamps a signal to +-1
+func clip(a Volts) Volts {
+	if math.Abs(float64(a)) > 1 {
+		if math.Signbit(float64(a)) {
+			return -1
+		}
+		return 1
+	}
+	return a // its ok, in range -1...+1
+}
+
+// PruneSounds removes any from the list that have finished playing by global time t
 func (syn *Synth) PruneSounds(t Seconds) {
-	newSounds := []*Sound{}
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
+	syn.prune(t)
+}
+
+// prune does, with mu held
+func (syn *Synth) prune(t Seconds) {
+	keep := syn.Sounds[:0]
 	for _, n := range syn.Sounds {
-		if n.End <= t {
-			newSounds = append(newSounds, n)
+		if n.End > t {
+			keep = append(keep, n)
+		}
+	}
+	for i := len(keep); i < len(syn.Sounds); i++ {
+		syn.Sounds[i] = nil // so they can be collected
+	}
+	syn.Sounds = keep
+}
+
+// Change makes changes to sounds that may be playing (new envelopes, glides, bends, releases...) while
+// they aren't being mixed. It mustn't add sounds.
+func (syn *Synth) Change(change func()) {
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
+	change()
+}
+
+// KeepSound puts back a sound that may have been pruned, e.g. a mono voice restarted after dying away
+func (syn *Synth) KeepSound(snd *Sound) {
+	syn.mu.Lock()
+	defer syn.mu.Unlock()
+	for _, s := range syn.Sounds {
+		if s == snd {
+			return
 		}
 	}
-	syn.Sounds = newSounds
+	syn.Sounds = append(syn.Sounds, snd)
 }
 
-// Stream satisifies beep.Streamer, computes the instantaneous amplitude for each channel.
+// Stream satisifies beep.Streamer, mixes the sounds through the mixer's tracks,
+// then runs the block through the master effects.
 func (syn *Synth) Stream(samples [][2]float64) (n int, ok bool) {
+	t0 := Seconds(syn.SampleNo) * syn.Tick
+	syn.mu.Lock()
+	syn.prune(t0)
+	syn.Mixer.Mix(syn.Sounds, t0, syn.Tick, samples)
+	syn.mu.Unlock()
+	syn.SampleNo += len(samples)
+	for _, fx := range syn.Effects {
+		fx.Process(samples)
+	}
 	for i := range samples {
-		when := Seconds(syn.SampleNo) * syn.Tick
-		aR := syn.Amplitude(when)
-		aL := syn.Amplitude(when)
-		samples[i][0] = float64(aR)
-		samples[i][1] = float64(aL)
+		aL := clip(Volts(samples[i][0]))
+		aR := clip(Volts(samples[i][1]))
+		samples[i][0] = float64(aL)
+		samples[i][1] = float64(aR)
+		if syn.Live != nil {
+			syn.Live.Write(aL, aR)
+		}
 		if syn.recordIt {
 			syn.recordingR = append(syn.recordingR, float64(aR))
 			syn.recordingL = append(syn.recordingL, float64(aL))
 		}
-		syn.SampleNo++
 	}
 	return len(samples), true
 }
 
 // Graphout draws an graphic of this synth
-func (syn Synth) Graphout() {
+func (syn *Synth) Graphout() {
 
 	nSamples := len(syn.recordingR)
 	nSecs := 1 + (nSamples / int(syn.SR))
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ████████╗██╗  ██╗███████╗██████╗ ███████╗███╗   ███╗██╗███╗   ██╗
+// ╚══██╔══╝██║  ██║██╔════╝██╔══██╗██╔════╝████╗ ████║██║████╗  ██║
+//    ██║   ███████║█████╗  ██████╔╝█████╗  ██╔████╔██║██║██╔██╗ ██║
+//    ██║   ██╔══██║██╔══╝  ██╔══██╗██╔══╝  ██║╚██╔╝██║██║██║╚██╗██║
+//    ██║   ██║  ██║███████╗██║  ██║███████╗██║ ╚═╝ ██║██║██║ ╚████║
+//    ╚═╝   ╚═╝  ╚═╝╚══════╝╚═╝  ╚═╝╚══════╝╚═╝     ╚═╝╚═╝╚═╝  ╚═══╝
+
+// The theremin is one continuous voice played by moving the mouse: across for pitch, up and down for
+// volume, with a button to let it sound. The mouse only moves every frame or so, so the pitch and level
+// chase where it is, sample by sample, and the oscillator keeps its phase as it is retuned, so nothing
+// clicks or steps however fast it is moved.
+
+// PitchMap is how position across maps to pitch
+type PitchMap int
+
+// Pitch maps
+const (
+	PitchLog    PitchMap = iota // Each octave is as wide, as on a keyboard (or a real theremin, roughly)
+	PitchLinear                 // Each Hertz is as wide, so octaves get wider going up
+)
+
+// thereminWaves are the timbres it morphs through, from dull to bright
+var thereminWaves = []Waveform{SineWave, TriangleWave, SawWave, SquareWave}
+
+// Theremin is a voice following a position
+type Theremin struct {
+	T0        Seconds // Global time it started
+	Osc       *Oscillator
+	Low, High Hertz    // Pitch at the left and right
+	Map       PitchMap //
+	Scale     Scale    // If set, the pitch snaps to its notes
+	Root      int      // Of the scale, 0 being C
+	Glide     Seconds  // Time constant the pitch follows with
+	Fade      Seconds  // Time the level takes to go from nothing to full
+	mu        sync.Mutex
+	x, y      float64 // Where it is, each 0...1
+	gate      bool
+	timbre    float64 // 0...1 through thereminWaves
+	ν, target Hertz
+	level     float64
+	lastT     Seconds
+	stopped   Seconds // When released, or 0
+}
+
+// NewTheremin makes one starting at global time t, silent until gated
+func NewTheremin(t Seconds, low, high Hertz) *Theremin {
+	th := &Theremin{T0: t, Low: low, High: high, Glide: 0.02, Fade: 0.02, y: 1, ν: low, target: low, lastT: t}
+	th.Osc = NewWave(t, low, th.wave)
+	return th
+}
+
+// Note makes a note of it, to be added to a synth at the time it started
+func (th *Theremin) Note() *Note {
+	return NewNote(th.T0, th.Low, thereminEnv{th}, th)
+}
+
+// wave morphs between neighbouring timbres
+func (th *Theremin) wave(a Angle) Volts {
+	x := th.timbre * float64(len(thereminWaves)-1)
+	i := int(x)
+	if i >= len(thereminWaves)-1 {
+		return thereminWaves[i](a)
+	}
+	f := Volts(x - float64(i))
+	return (1-f)*thereminWaves[i](a) + f*thereminWaves[i+1](a)
+}
+
+// Move sets where it is: x across (0 low, 1 high) and y for volume (0 silent, 1 full)
+func (th *Theremin) Move(x, y float64) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.x, th.y = math.Max(0, math.Min(1, x)), math.Max(0, math.Min(1, y))
+	th.target = th.pitch(th.x)
+}
+
+// pitch is the frequency at x
+func (th *Theremin) pitch(x float64) Hertz {
+	ν := th.Low * Hertz(math.Pow(float64(th.High/th.Low), x))
+	if th.Map == PitchLinear {
+		ν = th.Low + (th.High-th.Low)*Hertz(x)
+	}
+	if th.Scale != nil {
+		ν = KeyFreq(th.Scale.Snap(69+12*math.Log2(float64(ν/440)), th.Root))
+	}
+	return ν
+}
+
+// Gate lets it sound, or not
+func (th *Theremin) Gate(on bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.gate = on
+}
+
+// Timbre moves the timbre on by d, staying within dull (0) and bright (1)
+func (th *Theremin) Timbre(d float64) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.timbre = math.Max(0, math.Min(1, th.timbre+d))
+}
+
+// Retune changes the pitch map or scale, taking effect from where it is now
+func (th *Theremin) Retune(pm PitchMap, sc Scale) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.Map, th.Scale = pm, sc
+	th.target = th.pitch(th.x)
+}
+
+// Amplitude moves the pitch and level on towards where they should be, then plays
+func (th *Theremin) Amplitude(t Seconds) Volts {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	dt := float64(t - th.lastT)
+	th.lastT = t
+	if dt > 0 {
+		k := 1 - math.Exp(-dt/float64(th.Glide)) // glide in pitch, not frequency
+		th.ν *= Hertz(math.Pow(float64(th.target/th.ν), k))
+		want := 0.0
+		if th.gate && th.stopped == 0 {
+			want = th.y
+		}
+		step := dt / float64(th.Fade)
+		if th.level > want {
+			th.level = math.Max(want, th.level-step)
+		} else {
+			th.level = math.Min(want, th.level+step)
+		}
+		th.Osc.NewFreqAt(t, th.ν)
+	}
+	return th.Osc.Amplitude(t) * Volts(th.level)
+}
+
+// Pitch is where the pitch has got to, and whether it can be heard
+func (th *Theremin) Pitch() (Hertz, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.ν, th.level > 0
+}
+
+// Release stops it for good at global time t, fading out
+func (th *Theremin) Release(t Seconds) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.stopped = t
+}
+
+// String is its settings and where it is, for display
+func (th *Theremin) String() string {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	m := "log"
+	if th.Map == PitchLinear {
+		m = "linear"
+	}
+	return fmt.Sprintf("Theremin %-6s %7.1fHz  Level %.2f  Timbre %.2f", m, th.target, th.y, th.timbre)
+}
+
+// thereminEnv lets the theremin's note last until it is released and has faded out
+type thereminEnv struct {
+	th *Theremin
+}
+
+// Amplitude is always full; the theremin sets its own level
+func (e thereminEnv) Amplitude(t Seconds) Volts {
+	return 1
+}
+
+// Length is
+func (e thereminEnv) Length() Seconds {
+	e.th.mu.Lock()
+	defer e.th.mu.Unlock()
+	if e.th.stopped == 0 {
+		return MaxNoteLen
+	}
+	return e.th.stopped - e.th.T0 + e.th.Fade
+}
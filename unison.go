@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ██╗   ██╗███╗   ██╗██╗███████╗ ██████╗ ███╗   ██╗
+// ██║   ██║████╗  ██║██║██╔════╝██╔═══██╗████╗  ██║
+// ██║   ██║██╔██╗ ██║██║███████╗██║   ██║██╔██╗ ██║
+// ██║   ██║██║╚██╗██║██║╚════██║██║   ██║██║╚██╗██║
+// ╚██████╔╝██║ ╚████║██║███████║╚██████╔╝██║ ╚████║
+//  ╚═════╝ ╚═╝  ╚═══╝╚═╝╚══════╝ ╚═════╝ ╚═╝  ╚═══╝
+
+// Unison stacks several copies of an oscillator, each slightly detuned and placed across the stereo
+// field, so one note sounds wide (a supersaw, or a chorus-like pad). The copies drift in and out of
+// phase with each other, which is what makes it thick.
+
+// MaxUnison is the most copies a unison can have
+const MaxUnison = 16
+
+// DetuneCurve is how the copies' detunes are spread between the outermost ones
+type DetuneCurve int
+
+// Detune curves
+const (
+	DetuneLinear   DetuneCurve = iota // Evenly spaced
+	DetuneSupersaw                    // Bunched towards the centre, as the JP-8000's supersaw was
+)
+
+// UnisonOpts are the settings for a unison
+type UnisonOpts struct {
+	Voices      int         // Copies, 1...MaxUnison
+	Detune      float64     // Cents from the centre to the outermost copies
+	Curve       DetuneCurve //
+	Spread      float64     // Stereo width, 0 (all centre) to 1 (outermost copies hard left and right)
+	RandomPhase bool        // Start each copy at a random phase; otherwise all start at 0, and so in step
+	Seed        int64       // For the random phases
+}
+
+// Unison is a stack of detuned copies of an oscillator
+type Unison struct {
+	Opts   UnisonOpts
+	Copies []*Oscillator
+	ν      Hertz
+	ratios []Hertz   // Of each copy's frequency to the note's
+	gains  []float64 // Left and right gains of each copy, including the compensation
+	l, r   Volts
+	lastT  Seconds
+	ran    bool
+}
+
+// NewUnison makes one of a wave at ν, starting at global time t
+func NewUnison(t Seconds, ν Hertz, wave Waveform, opts UnisonOpts) *Unison {
+	n := opts.Voices
+	if n < 1 {
+		n = 1
+	}
+	if n > MaxUnison {
+		n = MaxUnison
+	}
+	opts.Voices = n
+	u := &Unison{Opts: opts, ν: ν, ratios: make([]Hertz, n), gains: make([]float64, 2*n)}
+	rnd := rand.New(rand.NewSource(opts.Seed))
+	comp := 1 / math.Sqrt(float64(n)) // the copies are uncorrelated, so add up by power
+	for i := 0; i < n; i++ {
+		x := 0.0 // where this copy sits, -1...+1
+		if n > 1 {
+			x = 2*float64(i)/float64(n-1) - 1
+		}
+		d := x
+		if opts.Curve == DetuneSupersaw {
+			d = math.Copysign(math.Pow(math.Abs(x), 1.5), x)
+		}
+		u.ratios[i] = Hertz(math.Pow(2, d*opts.Detune/1200))
+		osc := NewWave(t, ν*u.ratios[i], wave)
+		if opts.RandomPhase {
+			osc.Phase = Angle(τ * rnd.Float64())
+		}
+		u.Copies = append(u.Copies, osc)
+		l, r := panGains(x * opts.Spread)
+		u.gains[2*i], u.gains[2*i+1] = l*comp, r*comp
+	}
+	return u
+}
+
+// NewFreq retunes every copy, keeping their detunes
+func (u *Unison) NewFreq(ν Hertz) {
+	for i, osc := range u.Copies {
+		osc.NewFreq(ν * u.ratios[i])
+	}
+	u.ν = ν
+}
+
+// Freq is the note's frequency, in the middle of the copies
+func (u *Unison) Freq() Hertz {
+	return u.ν
+}
+
+// AmplitudeLR is the stack's left and right signals at global time t, worked out once for each t
+func (u *Unison) AmplitudeLR(t Seconds) (l, r Volts) {
+	if u.ran && t == u.lastT {
+		return u.l, u.r
+	}
+	u.ran, u.lastT = true, t
+	u.l, u.r = 0, 0
+	for i, osc := range u.Copies {
+		a := osc.Amplitude(t)
+		u.l += a * Volts(u.gains[2*i])
+		u.r += a * Volts(u.gains[2*i+1])
+	}
+	return u.l, u.r
+}
+
+// Amplitude is the stack in mono
+func (u *Unison) Amplitude(t Seconds) Volts {
+	l, r := u.AmplitudeLR(t)
+	return (l + r) / 2
+}
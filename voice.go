@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ██╗   ██╗ ██████╗ ██╗ ██████╗███████╗
+// ██║   ██║██╔═══██╗██║██╔════╝██╔════╝
+// ██║   ██║██║   ██║██║██║     █████╗
+// ╚██╗ ██╔╝██║   ██║██║██║     ██╔══╝
+//  ╚████╔╝ ╚██████╔╝██║╚██████╗███████╗
+//   ╚═══╝   ╚═════╝ ╚═╝ ╚═════╝╚══════╝
+
+// A Voice is the definition of a sound: a set of named Stages with wires from their output ports to other
+// stages' input ports, which must not loop. A Voice is never played itself; each Note gets its own
+// VoiceInstance, with fresh stages (so fresh oscillator phases, envelopes and filter states).
+
+// PortKind is the type of signal a port carries
+type PortKind int
+
+// Port kinds. Audio and Control signals are both Volts and may be wired to each other; Freq only to Freq.
+const (
+	AudioPort   PortKind = iota // Volts, ±1
+	ControlPort                 // Volts, usually 0...1 (e.g. an envelope level)
+	FreqPort                    // Hertz
+)
+
+func (k PortKind) String() string {
+	return [...]string{"audio", "control", "freq"}[k]
+}
+
+// fits says whether a port of this kind may feed one of kind to
+func (k PortKind) fits(to PortKind) bool {
+	return (k == FreqPort) == (to == FreqPort)
+}
+
+// Port is one input or output of a stage
+type Port struct {
+	Name    string
+	Kind    PortKind
+	Default float64 // Value of an input when nothing is wired to it
+}
+
+// Stage is one component of a voice. Process is called once per sample, in time order, with the values
+// on the input ports; it fills in the outputs.
+type Stage interface {
+	Inputs() []Port
+	Outputs() []Port
+	Process(t Seconds, in []float64, out []float64)
+}
+
+// NoteContext is what a stage may want to know about the note it is being made for
+type NoteContext struct {
+	Start    Seconds // Global time the note starts
+	Freq     Hertz   // The note's pitch
+	Velocity float64 // 0...1
+}
+
+// StageMaker makes a fresh stage for a note
+type StageMaker func(nc NoteContext) Stage
+
+// Voicer is anything that can make a playable instance of itself for a note
+type Voicer interface {
+	Instance(nc NoteContext) *VoiceInstance
+}
+
+// Wire joins an output port of one stage to an input port of another
+type Wire struct {
+	From, FromPort string
+	To, ToPort     string
+}
+
+func (w Wire) String() string {
+	return fmt.Sprintf("%s.%s -> %s.%s", w.From, w.FromPort, w.To, w.ToPort)
+}
+
+// voiceStage is a named stage of a voice definition, with a prototype to learn its ports from
+type voiceStage struct {
+	name  string
+	make  StageMaker
+	proto Stage
+}
+
+// Voice is a graph of stages
+type Voice struct {
+	Name   string
+	stages []*voiceStage
+	byName map[string]*voiceStage
+	wires  []Wire
+	order  []int // Stage indices, each after everything feeding it
+}
+
+// NewVoice makes an empty one
+func NewVoice(name string) *Voice {
+	return &Voice{Name: name, byName: map[string]*voiceStage{}}
+}
+
+// Add puts a named stage into the voice
+func (v *Voice) Add(name string, mk StageMaker) error {
+	if name == "" || strings.Contains(name, ".") {
+		return fmt.Errorf("voice %s: bad stage name %q", v.Name, name)
+	}
+	if _, dup := v.byName[name]; dup {
+		return fmt.Errorf("voice %s: stage %q already exists", v.Name, name)
+	}
+	vs := &voiceStage{name: name, make: mk, proto: mk(NoteContext{Freq: MiddleCfreq, Velocity: 1})}
+	v.stages = append(v.stages, vs)
+	v.byName[name] = vs
+	v.order = append(v.order, len(v.stages)-1) // nothing feeds it yet
+	return nil
+}
+
+// Stages lists the names of the stages, in the order they were added
+func (v *Voice) Stages() []string {
+	names := []string{}
+	for _, vs := range v.stages {
+		names = append(names, vs.name)
+	}
+	return names
+}
+
+// Wires lists the connections
+func (v *Voice) Wires() []Wire {
+	return append([]Wire{}, v.wires...)
+}
+
+// Connect wires "stage.port" to "stage.port"; leaving off the port means the stage's first output
+// (on the left) or first input (on the right)
+func (v *Voice) Connect(from, to string) error {
+	w := Wire{}
+	var err error
+	var src, dst *Port
+	if w.From, w.FromPort, src, err = v.port(from, false); err != nil {
+		return err
+	}
+	if w.To, w.ToPort, dst, err = v.port(to, true); err != nil {
+		return err
+	}
+	if !src.Kind.fits(dst.Kind) {
+		return fmt.Errorf("voice %s: can't wire %s output %s to %s input %s", v.Name, src.Kind, from, dst.Kind, to)
+	}
+	v.wires = append(v.wires, w)
+	if err := v.sort(); err != nil {
+		v.wires = v.wires[:len(v.wires)-1]
+		return err
+	}
+	return nil
+}
+
+// Chain wires each stage's first output to the next one's first input, e.g. Chain("osc", "lp", "out")
+func (v *Voice) Chain(names ...string) error {
+	for i := 1; i < len(names); i++ {
+		if err := v.Connect(names[i-1], names[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// port finds "stage.port" (or just "stage"), among the inputs or the outputs
+func (v *Voice) port(ref string, input bool) (stage, port string, p *Port, err error) {
+	stage, port = ref, ""
+	if dot := strings.Index(ref, "."); dot >= 0 {
+		stage, port = ref[:dot], ref[dot+1:]
+	}
+	vs, ok := v.byName[stage]
+	if !ok {
+		return "", "", nil, fmt.Errorf("voice %s: no stage %q", v.Name, stage)
+	}
+	ports, side := vs.proto.Outputs(), "output"
+	if input {
+		ports, side = vs.proto.Inputs(), "input"
+	}
+	if len(ports) == 0 {
+		return "", "", nil, fmt.Errorf("voice %s: stage %q has no %ss", v.Name, stage, side)
+	}
+	if port == "" {
+		return stage, ports[0].Name, &ports[0], nil
+	}
+	for i := range ports {
+		if ports[i].Name == port {
+			return stage, port, &ports[i], nil
+		}
+	}
+	return "", "", nil, fmt.Errorf("voice %s: stage %q has no %s %q", v.Name, stage, side, port)
+}
+
+// sort orders the stages so each comes after everything feeding it, failing on a loop
+func (v *Voice) sort() error {
+	index := map[string]int{}
+	for i, vs := range v.stages {
+		index[vs.name] = i
+	}
+	order := []int{}
+	state := make([]int, len(v.stages)) // 1 visiting, 2 done
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("voice %s: wiring loops through stage %q", v.Name, v.stages[i].name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, w := range v.wires {
+			if w.To == v.stages[i].name {
+				if err := visit(index[w.From]); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = 2
+		order = append(order, i)
+		return nil
+	}
+	for i := range v.stages {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	v.order = order
+	return nil
+}
+
+// feed is where one input gets (part of) its value
+type feed struct {
+	stage, port int // Source output
+	in          int // Input it adds into
+}
+
+// instStage is a stage of a voice instance with its port values
+type instStage struct {
+	Stage
+	in, out  []float64
+	defaults []float64
+	wired    []bool // Which inputs have something wired to them
+	feeds    []feed
+}
+
+// VoiceInstance is a voice being played by one note
+type VoiceInstance struct {
+	Voice  *Voice
+	stages []*instStage // In processing order
+	lastT  Seconds
+	ran    bool
+	l, r   Volts
+}
+
+// Instance makes fresh stages for a note, wired up as the voice says
+func (v *Voice) Instance(nc NoteContext) *VoiceInstance {
+	vi := &VoiceInstance{Voice: v}
+	pos := map[string]int{} // stage name to position in vi.stages
+	for _, i := range v.order {
+		vs := v.stages[i]
+		st := vs.make(nc)
+		is := &instStage{Stage: st, out: make([]float64, len(st.Outputs()))}
+		for _, p := range st.Inputs() {
+			is.defaults = append(is.defaults, p.Default)
+		}
+		is.in = make([]float64, len(is.defaults))
+		is.wired = make([]bool, len(is.defaults))
+		pos[vs.name] = len(vi.stages)
+		vi.stages = append(vi.stages, is)
+	}
+	for _, w := range v.wires {
+		src, dst := vi.stages[pos[w.From]], vi.stages[pos[w.To]]
+		f := feed{stage: pos[w.From], port: portIndex(src.Outputs(), w.FromPort), in: portIndex(dst.Inputs(), w.ToPort)}
+		dst.feeds = append(dst.feeds, f)
+		dst.wired[f.in] = true
+	}
+	return vi
+}
+
+// portIndex is the position of the named port
+func portIndex(ports []Port, name string) int {
+	for i, p := range ports {
+		if p.Name == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// run processes every stage for global time t (once only, however many times it is asked)
+func (vi *VoiceInstance) run(t Seconds) {
+	if vi.ran && t == vi.lastT {
+		return
+	}
+	vi.ran, vi.lastT = true, t
+	vi.l, vi.r = 0, 0
+	for _, is := range vi.stages {
+		for i := range is.in {
+			if is.wired[i] {
+				is.in[i] = 0
+			} else {
+				is.in[i] = is.defaults[i]
+			}
+		}
+		for _, f := range is.feeds {
+			is.in[f.in] += vi.stages[f.stage].out[f.port]
+		}
+		is.Process(t, is.in, is.out)
+		if ch, ok := is.Stage.(*ChannelStage); ok {
+			l, r := ch.Levels()
+			vi.l += l
+			vi.r += r
+		}
+	}
+}
+
+// AmplitudeLR is the sum of everything reaching the voice's Channel stages
+func (vi *VoiceInstance) AmplitudeLR(t Seconds) (l, r Volts) {
+	vi.run(t)
+	return vi.l, vi.r
+}
+
+// Amplitude is the mono mix of the voice
+func (vi *VoiceInstance) Amplitude(t Seconds) Volts {
+	vi.run(t)
+	return (vi.l + vi.r) / 2
+}
+
+// Release tells every stage that cares that the note has been let go
+func (vi *VoiceInstance) Release(t Seconds) {
+	for _, is := range vi.stages {
+		if r, ok := is.Stage.(Releaser); ok {
+			r.Release(t)
+		}
+	}
+}
+
+// Length is that of the longest envelope in the voice, or MaxNoteLen if there are none
+func (vi *VoiceInstance) Length() Seconds {
+	l := Seconds(0)
+	found := false
+	for _, is := range vi.stages {
+		if e, ok := is.Stage.(Enveloper); ok {
+			l = max(l, e.Length())
+			found = true
+		}
+	}
+	if !found {
+		return MaxNoteLen
+	}
+	return l
+}
+
+// voiceEnv lets a note last as long as its voice, leaving the shaping to the voice's own envelopes
+type voiceEnv struct {
+	vi *VoiceInstance
+}
+
+// Amplitude is
+func (ve voiceEnv) Amplitude(t Seconds) Volts {
+	return 1
+}
+
+// Length is
+func (ve voiceEnv) Length() Seconds {
+	return ve.vi.Length()
+}
+
+// NewVoiceNote makes a note played by an instance of a voice
+func NewVoiceNote(start Seconds, freq Hertz, velocity float64, v Voicer) *Note {
+	vi := v.Instance(NoteContext{Start: start, Freq: freq, Velocity: velocity})
+	n := NewNote(start, freq, voiceEnv{vi}, vi)
+	n.Voice = v
+	return n
+}